@@ -0,0 +1,153 @@
+package annotations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+const (
+	apiKeyHeader = "X-Api-Key"
+
+	publicTier  = "public"
+	partnerTier = "partner"
+)
+
+// tiers lists the known access tiers in the order of increasing privileges.
+var tiers = []string{publicTier, partnerTier}
+
+// restrictedFields defines the annotation fields that are only rendered for callers of a given tier or above.
+var restrictedFields = []restrictedField{
+	{name: "leiCode", tier: partnerTier, clear: func(a *annotation) { a.LeiCode = "" }},
+	{name: "FIGI", tier: partnerTier, clear: func(a *annotation) { a.FIGI = "" }},
+	{name: "instruments", tier: partnerTier, clear: func(a *annotation) { a.Instruments = nil }},
+}
+
+type restrictedField struct {
+	name  string
+	tier  string
+	clear func(*annotation)
+}
+
+type tierContextKey struct{}
+
+// AccessConfig maps API keys to the access tier granted to their holders and configures the rate limit of each tier.
+type AccessConfig struct {
+	Keys  map[string]string    `json:"keys"`
+	Tiers map[string]RateLimit `json:"tiers"`
+}
+
+// LoadAccessConfig reads the API keys configuration from a JSON file.
+// An empty path results in a configuration without keys, so every caller gets the public tier.
+func LoadAccessConfig(path string) (AccessConfig, error) {
+	cfg := AccessConfig{Keys: map[string]string{}, Tiers: map[string]RateLimit{}}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed reading access config %s: %w", path, err)
+	}
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed parsing access config %s: %w", path, err)
+	}
+	for _, tier := range cfg.Keys {
+		if tierLevel(tier) == -1 {
+			return cfg, fmt.Errorf("unknown tier %q in access config %s", tier, path)
+		}
+	}
+	for tier, limit := range cfg.Tiers {
+		if tierLevel(tier) == -1 {
+			return cfg, fmt.Errorf("unknown tier %q in access config %s", tier, path)
+		}
+		if limit.Rate > 0 && limit.Burst < 1 {
+			return cfg, fmt.Errorf("rate limit of tier %q in access config %s needs a burst of at least 1", tier, path)
+		}
+	}
+	return cfg, nil
+}
+
+// APIKeyMiddleware resolves the access tier of the caller from the X-Api-Key header and stores it in the request context.
+// Requests without a key get the public tier, requests with an unknown key are rejected.
+func APIKeyMiddleware(cfg AccessConfig, log *logger.UPPLogger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tier := publicTier
+		if key := r.Header.Get(apiKeyHeader); key != "" {
+			var ok bool
+			if tier, ok = cfg.Keys[key]; !ok {
+				w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+				w.WriteHeader(http.StatusUnauthorized)
+				msg := `{"message":"invalid api key"}`
+				if _, err := w.Write([]byte(msg)); err != nil {
+					log.WithError(err).Errorf("Error while writing response: %s", msg)
+				}
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tierContextKey{}, tier)))
+	})
+}
+
+func tierFromRequest(r *http.Request) string {
+	if tier, ok := r.Context().Value(tierContextKey{}).(string); ok {
+		return tier
+	}
+	return publicTier
+}
+
+func tierLevel(tier string) int {
+	for level, t := range tiers {
+		if t == tier {
+			return level
+		}
+	}
+	return -1
+}
+
+// varyOnTier tells the shared caches that the response depends on the access tier of the caller, as its fields are restricted by tier.
+func varyOnTier(w http.ResponseWriter) {
+	w.Header().Add("Vary", apiKeyHeader)
+}
+
+// tierCacheControl returns the given Cache-Control header for the public tier,
+// the responses of the other tiers may hold licensed fields so only the caller can cache them.
+func tierCacheControl(r *http.Request, cacheControl string) string {
+	if tierFromRequest(r) != publicTier {
+		return "private"
+	}
+	return cacheControl
+}
+
+// requirePartnerTier responds with 403 Forbidden unless the caller has the partner tier or above, returning whether the request may go on.
+// It guards the query parameters revealing the lifecycles of the annotations or the annotations pruned by the filters.
+func (hctx *HandlerCtx) requirePartnerTier(w http.ResponseWriter, r *http.Request, feature string) bool {
+	if tierLevel(tierFromRequest(r)) >= tierLevel(partnerTier) {
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusForbidden)
+	msg := fmt.Sprintf(`{"message":"%s requires a partner API key"}`, feature)
+	if _, err := w.Write([]byte(msg)); err != nil {
+		hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+	}
+	return false
+}
+
+// restrictFields clears the fields the given tier is not allowed to see.
+func restrictFields(anns []annotation, tier string) []annotation {
+	level := tierLevel(tier)
+	for i := range anns {
+		for _, f := range restrictedFields {
+			if level < tierLevel(f.tier) {
+				f.clear(&anns[i])
+			}
+		}
+	}
+	return anns
+}
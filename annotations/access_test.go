@@ -0,0 +1,138 @@
+package annotations
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testAccessConfig = AccessConfig{Keys: map[string]string{
+	"public-key":  publicTier,
+	"partner-key": partnerTier,
+}}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	tests := map[string]struct {
+		apiKey             string
+		expectedStatusCode int
+		expectedTier       string
+	}{
+		"request without api key gets the public tier": {
+			expectedStatusCode: http.StatusOK,
+			expectedTier:       publicTier,
+		},
+		"request with a public api key gets the public tier": {
+			apiKey:             "public-key",
+			expectedStatusCode: http.StatusOK,
+			expectedTier:       publicTier,
+		},
+		"request with a partner api key gets the partner tier": {
+			apiKey:             "partner-key",
+			expectedStatusCode: http.StatusOK,
+			expectedTier:       partnerTier,
+		},
+		"request with an unknown api key is rejected": {
+			apiKey:             "unknown-key",
+			expectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var tier string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tier = tierFromRequest(r)
+			})
+			req := httptest.NewRequest("GET", "/content/"+knownUUID+"/annotations", nil)
+			if tc.apiKey != "" {
+				req.Header.Set(apiKeyHeader, tc.apiKey)
+			}
+			rec := httptest.NewRecorder()
+
+			APIKeyMiddleware(testAccessConfig, logger.NewUPPLogger("test-public-annotations-api", "PANIC"), next).ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			assert.Equal(t, tc.expectedTier, tier)
+		})
+	}
+}
+
+func TestGetHandlerRestrictsFieldsByTier(t *testing.T) {
+	d := mockDriver{
+		readFunc: func(string, readOptions) (readResult, error) {
+			return readResult{anns: []annotation{{
+				Predicate: "http://www.ft.com/ontology/annotation/mentions",
+				ID:        "http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400",
+				LeiCode:   "BQ4BKCS1HXDV9TTTTTTTT",
+				FIGI:      "BB8000C3P0-R2D2",
+			}}, found: true}, nil
+		},
+	}
+	tests := map[string]struct {
+		apiKey               string
+		expectedBody         string
+		expectedCacheControl string
+	}{
+		"public callers do not see licensed fields": {
+			expectedBody:         `[{"predicate":"http://www.ft.com/ontology/annotation/mentions","id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400","apiUrl":"","types":null}]`,
+			expectedCacheControl: "test-header",
+		},
+		"partners see licensed fields": {
+			apiKey:               "partner-key",
+			expectedBody:         `[{"predicate":"http://www.ft.com/ontology/annotation/mentions","id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400","apiUrl":"","types":null,"leiCode":"BQ4BKCS1HXDV9TTTTTTTT","FIGI":"BB8000C3P0-R2D2"}]`,
+			expectedCacheControl: "private",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			log := logger.NewUPPLogger("test-public-annotations-api", "PANIC")
+			hctx := NewHandlerCtx(d, "test-header", log)
+			r := mux.NewRouter()
+			r.HandleFunc("/content/{uuid}/annotations", GetAnnotations(hctx)).Methods("GET")
+
+			req := httptest.NewRequest("GET", fmt.Sprintf("/content/%s/annotations", knownUUID), nil)
+			if tc.apiKey != "" {
+				req.Header.Set(apiKeyHeader, tc.apiKey)
+			}
+			rec := httptest.NewRecorder()
+			APIKeyMiddleware(testAccessConfig, log, r).ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.JSONEq(t, tc.expectedBody, rec.Body.String())
+			assert.Equal(t, tc.expectedCacheControl, rec.Header().Get("Cache-Control"), "only the public responses should be cached by shared caches")
+			assert.Equal(t, apiKeyHeader, rec.Header().Get("Vary"), "the response should vary with the api key")
+		})
+	}
+}
+
+func TestLoadAccessConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "access-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	valid := filepath.Join(dir, "valid.json")
+	require.NoError(t, ioutil.WriteFile(valid, []byte(`{"keys":{"abc":"partner"}}`), 0600))
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, ioutil.WriteFile(invalid, []byte(`{"keys":{"abc":"platinum"}}`), 0600))
+
+	cfg, err := LoadAccessConfig(valid)
+	assert.NoError(t, err)
+	assert.Equal(t, partnerTier, cfg.Keys["abc"])
+
+	_, err = LoadAccessConfig(invalid)
+	assert.Error(t, err, "unknown tiers should be rejected")
+
+	cfg, err = LoadAccessConfig("")
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.Keys)
+}
@@ -31,6 +31,8 @@ func (chain *annotationsFilterChain) doNext(ann []annotation) []annotation {
 }
 
 type dedupFilter struct {
+	// perLifecycle keeps the same annotation once per lifecycle
+	perLifecycle bool
 }
 
 var defaultDedupFilter = &dedupFilter{}
@@ -41,7 +43,7 @@ func (f *dedupFilter) filter(in []annotation, chain *annotationsFilterChain) []a
 OUTER:
 	for _, ann := range in {
 		for _, copied := range out {
-			if copied.Predicate == ann.Predicate && copied.ID == ann.ID {
+			if copied.Predicate == ann.Predicate && copied.ID == ann.ID && (!f.perLifecycle || copied.Lifecycle == ann.Lifecycle) {
 				continue OUTER
 			}
 		}
@@ -0,0 +1,211 @@
+package annotations
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Names of the routes whose filter chains can be configured.
+const (
+	annotationsRoute = "annotations"
+	summaryRoute     = "summary"
+	relatedRoute     = "related"
+	historyRoute     = "history"
+	changesRoute     = "changes"
+)
+
+var filterRoutes = []string{annotationsRoute, summaryRoute, relatedRoute, historyRoute, changesRoute}
+
+// defaultFilters is the filter chain of the routes that are not configured.
+var defaultFilters = []string{"lifecycle", "importance", "dedup"}
+
+// filterRequest holds what the filters know of the request whose annotations they filter.
+type filterRequest struct {
+	lifecycles []string
+	// view of the annotations requested, empty for the default one
+	view string
+}
+
+// namedFilter is a filter that can be composed into the chain of a route by its name.
+type namedFilter struct {
+	name string
+	// newFilter creates the filter for a single use, as filters may hold state
+	newFilter func(req filterRequest) annotationsFilter
+	// dropReason explains why the filter dropped an annotation of in that is not in out, for the explain command
+	dropReason func(ann annotation, in []annotation, out []annotation) string
+}
+
+// filterRegistry lists the filters that can be composed into the chain of a route.
+// New filters are registered here and configured by name, the handlers do not refer to them.
+var filterRegistry = []namedFilter{
+	{
+		name: "lifecycle",
+		newFilter: func(req filterRequest) annotationsFilter {
+			switch req.view {
+			case rawView:
+				return newLifecycleFilter(withLifecycles(req.lifecycles), withoutPrecedence())
+			case mergedView:
+				return newLifecycleFilter(withLifecycles(req.lifecycles), withoutPrecedence(), withMergedLifecycles())
+			}
+			return newLifecycleFilter(withLifecycles(req.lifecycles))
+		},
+		dropReason: func(ann annotation, in []annotation, _ []annotation) string {
+			if containsPACLifecycle(in) && ann.Lifecycle != pacLifecycle && ann.Lifecycle != v2Lifecycle {
+				return "PAC annotations supersede the other lifecycles"
+			}
+			return "lifecycle not requested"
+		},
+	},
+	{
+		name: "importance",
+		newFilter: func(filterRequest) annotationsFilter {
+			return NewAnnotationsPredicateFilter()
+		},
+		dropReason: func(ann annotation, _ []annotation, out []annotation) string {
+			for _, kept := range out {
+				if kept.Predicate == ann.Predicate && kept.ID == ann.ID {
+					return duplicateReason
+				}
+			}
+			return "a more important predicate annotates the same concept"
+		},
+	},
+	{
+		name: "dedup",
+		newFilter: func(req filterRequest) annotationsFilter {
+			if req.view == rawView {
+				return &dedupFilter{perLifecycle: true}
+			}
+			return defaultDedupFilter
+		},
+		dropReason: func(annotation, []annotation, []annotation) string {
+			return duplicateReason
+		},
+	},
+}
+
+const duplicateReason = "duplicate of another annotation"
+
+func lookupFilter(name string) (namedFilter, bool) {
+	for _, f := range filterRegistry {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return namedFilter{}, false
+}
+
+// FiltersConfig maps the names of the routes to the names of the filters applied to their annotations, in order.
+// The routes that are not configured apply the lifecycle, importance and dedup filters.
+type FiltersConfig map[string][]string
+
+// LoadFiltersConfig reads the filter chains of the routes from a JSON file.
+// An empty path results in the default chain for every route.
+func LoadFiltersConfig(path string) (FiltersConfig, error) {
+	cfg := FiltersConfig{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed reading filters config %s: %w", path, err)
+	}
+	if err = json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed parsing filters config %s: %w", path, err)
+	}
+	if err = cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("invalid filters config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (c FiltersConfig) validate() error {
+	for route, names := range c {
+		if !containsString(filterRoutes, route) {
+			return fmt.Errorf("unknown route %q", route)
+		}
+		for i, name := range names {
+			if _, ok := lookupFilter(name); !ok {
+				return fmt.Errorf("route %s: unknown filter %q", route, name)
+			}
+			if containsString(names[:i], name) {
+				return fmt.Errorf("route %s: duplicate filter %q", route, name)
+			}
+		}
+	}
+	return nil
+}
+
+// chain returns the names of the filters of the route.
+func (c FiltersConfig) chain(route string) []string {
+	if names, ok := c[route]; ok {
+		return names
+	}
+	return defaultFilters
+}
+
+// filterChain returns the names of the filters of the route as toggled by the filters query parameter,
+// a comma separated list where -name removes a filter from the chain and name or +name appends it.
+func (hctx *HandlerCtx) filterChain(route string, params url.Values) ([]string, error) {
+	names := append([]string(nil), hctx.filters.chain(route)...)
+	for _, param := range params["filters"] {
+		for _, toggle := range strings.Split(param, ",") {
+			// a + is decoded as a space when not escaped
+			toggle = strings.TrimSpace(toggle)
+			name := strings.TrimLeft(toggle, "+-")
+			if _, ok := lookupFilter(name); !ok {
+				return nil, fmt.Errorf("invalid filters value: %s", toggle)
+			}
+			names = removeString(names, name)
+			if !strings.HasPrefix(toggle, "-") {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// allowFilterToggles reserves the filters query parameter to the partner tier and above,
+// as turning the filters off reveals the annotations they prune, e.g. those of the other lifecycles.
+func (hctx *HandlerCtx) allowFilterToggles(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := r.URL.Query()["filters"]; !ok {
+		return true
+	}
+	return hctx.requirePartnerTier(w, r, "The filters query parameter")
+}
+
+// applyFilters runs the annotations through the named filters, in order.
+func applyFilters(anns []annotation, names []string, req filterRequest) []annotation {
+	filters := make([]annotationsFilter, 0, len(names))
+	for _, name := range names {
+		if f, ok := lookupFilter(name); ok {
+			filters = append(filters, f.newFilter(req))
+		}
+	}
+	chain := &annotationsFilterChain{filters: filters}
+	return chain.doNext(anns)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(values []string, value string) []string {
+	var kept []string
+	for _, v := range values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
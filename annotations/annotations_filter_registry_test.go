@@ -0,0 +1,215 @@
+package annotations
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFiltersConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filters-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		content       string
+		expected      FiltersConfig
+		expectedError bool
+	}{
+		"filter chains per route": {
+			content:  `{"annotations":["lifecycle","dedup"],"related":[]}`,
+			expected: FiltersConfig{"annotations": {"lifecycle", "dedup"}, "related": {}},
+		},
+		"unknown route": {
+			content:       `{"content":["lifecycle"]}`,
+			expectedError: true,
+		},
+		"unknown filter": {
+			content:       `{"annotations":["lifecycle","relevance"]}`,
+			expectedError: true,
+		},
+		"duplicate filter": {
+			content:       `{"annotations":["dedup","lifecycle","dedup"]}`,
+			expectedError: true,
+		},
+		"invalid json": {
+			content:       `["lifecycle"]`,
+			expectedError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "filters.json")
+			require.NoError(t, ioutil.WriteFile(path, []byte(tc.content), 0600))
+
+			cfg, err := LoadFiltersConfig(path)
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, cfg)
+		})
+	}
+
+	cfg, err := LoadFiltersConfig("")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultFilters, cfg.chain(annotationsRoute), "every route should apply the default filters without a config")
+}
+
+func TestFilterChain(t *testing.T) {
+	hctx := NewHandlerCtx(mockDriver{}, "", logger.NewUPPLogger("test-public-annotations-api", "PANIC"),
+		WithFilters(FiltersConfig{relatedRoute: {"importance"}}))
+
+	tests := map[string]struct {
+		route         string
+		query         string
+		expected      []string
+		expectedError bool
+	}{
+		"default chain": {
+			route:    annotationsRoute,
+			expected: []string{"lifecycle", "importance", "dedup"},
+		},
+		"configured chain": {
+			route:    relatedRoute,
+			expected: []string{"importance"},
+		},
+		"filter removed": {
+			route:    annotationsRoute,
+			query:    "filters=-importance",
+			expected: []string{"lifecycle", "dedup"},
+		},
+		"every filter removed": {
+			route: annotationsRoute,
+			query: "filters=-lifecycle,-importance&filters=-dedup",
+		},
+		"filter appended": {
+			route:    relatedRoute,
+			query:    "filters=dedup",
+			expected: []string{"importance", "dedup"},
+		},
+		"filter appended with an unescaped plus": {
+			route:    relatedRoute,
+			query:    "filters=+lifecycle",
+			expected: []string{"importance", "lifecycle"},
+		},
+		"filter moved to the end of the chain": {
+			route:    annotationsRoute,
+			query:    "filters=%2Blifecycle",
+			expected: []string{"importance", "dedup", "lifecycle"},
+		},
+		"unknown filter": {
+			route:         annotationsRoute,
+			query:         "filters=-relevance",
+			expectedError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			params, err := url.ParseQuery(tc.query)
+			require.NoError(t, err)
+
+			names, err := hctx.filterChain(tc.route, params)
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+}
+
+func TestApplyFilters(t *testing.T) {
+	msjMentions := historyMSJ
+	msjMentions.Predicate = predicates["MENTIONS"]
+	anns := []annotation{historyFakebook, historyMSJ, msjMentions, historyMSJ}
+
+	assert.ElementsMatch(t, []annotation{historyFakebook, historyMSJ}, applyFilters(anns, defaultFilters, filterRequest{}))
+	assert.ElementsMatch(t, []annotation{historyFakebook, historyMSJ, msjMentions}, applyFilters(anns, []string{"lifecycle", "dedup"}, filterRequest{}),
+		"the less important annotations should be kept without the importance filter")
+	assert.ElementsMatch(t, []annotation{historyMSJ, msjMentions}, applyFilters(anns, []string{"lifecycle", "dedup"}, filterRequest{lifecycles: []string{"pac"}}))
+	assert.Equal(t, anns, applyFilters(anns, nil, filterRequest{}), "the annotations should be returned as read without filters")
+}
+
+func TestGetHandlerWithFiltersQueryParam(t *testing.T) {
+	msjMentions := historyMSJ
+	msjMentions.Predicate = predicates["MENTIONS"]
+	d := mockDriver{
+		readFunc: func(string, readOptions) (readResult, error) {
+			return readResult{anns: []annotation{historyFakebook, historyMSJ, msjMentions}, found: true}, nil
+		},
+	}
+
+	tests := map[string]struct {
+		filters            FiltersConfig
+		query              string
+		tier               string
+		expectedStatusCode int
+		expectedIDs        []string
+	}{
+		"default filters": {
+			expectedStatusCode: http.StatusOK,
+			expectedIDs:        []string{historyFakebook.ID, historyMSJ.ID},
+		},
+		"importance filter removed": {
+			query:              "?filters=-importance",
+			tier:               partnerTier,
+			expectedStatusCode: http.StatusOK,
+			expectedIDs:        []string{historyFakebook.ID, historyMSJ.ID, historyMSJ.ID},
+		},
+		"filters toggled without a partner key": {
+			query:              "?filters=-lifecycle",
+			expectedStatusCode: http.StatusForbidden,
+		},
+		"filters configured for the route": {
+			filters:            FiltersConfig{annotationsRoute: {"dedup"}},
+			expectedStatusCode: http.StatusOK,
+			expectedIDs:        []string{historyFakebook.ID, historyMSJ.ID, historyMSJ.ID},
+		},
+		"filters configured for another route": {
+			filters:            FiltersConfig{summaryRoute: {"dedup"}},
+			expectedStatusCode: http.StatusOK,
+			expectedIDs:        []string{historyFakebook.ID, historyMSJ.ID},
+		},
+		"unknown filter": {
+			query:              "?filters=-relevance",
+			tier:               partnerTier,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			hctx := NewHandlerCtx(d, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC"), WithFilters(tc.filters))
+			r := mux.NewRouter()
+			r.HandleFunc("/content/{uuid}/annotations", GetAnnotations(hctx)).Methods("GET")
+
+			req := httptest.NewRequest("GET", fmt.Sprintf("/content/%s/annotations%s", knownUUID, tc.query), nil)
+			if tc.tier != "" {
+				req = req.WithContext(context.WithValue(req.Context(), tierContextKey{}, tc.tier))
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			if tc.expectedIDs != nil {
+				assert.ElementsMatch(t, tc.expectedIDs, responseIDs(t, rec))
+			}
+		})
+	}
+}
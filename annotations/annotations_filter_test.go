@@ -44,3 +44,17 @@ func TestDedupFilterDedups(t *testing.T) {
 	assert.Equal(t, actual[0].ID, "2", "concept id")
 	assert.Equal(t, actual[0].Predicate, "baz", "predicate")
 }
+
+func TestDedupFilterPerLifecycle(t *testing.T) {
+	chain := &annotationsFilterChain{filters: []annotationsFilter{&dedupFilter{perLifecycle: true}}}
+
+	ann := []annotation{
+		{ID: "2", Predicate: "baz", Lifecycle: pacLifecycle},
+		{ID: "2", Predicate: "baz", Lifecycle: v2Lifecycle},
+		{ID: "2", Predicate: "baz", Lifecycle: pacLifecycle},
+	}
+
+	actual := chain.doNext(ann)
+
+	assert.Equal(t, ann[:2], actual, "the same annotation should be kept once per lifecycle")
+}
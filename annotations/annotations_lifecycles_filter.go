@@ -14,6 +14,10 @@ var lifecycleMap = map[string]string{
 
 type lifecycleFilter struct {
 	lifecycles []string
+	// ignorePrecedence keeps the other lifecycles alongside the PAC annotations
+	ignorePrecedence bool
+	// mergeLifecycles merges the annotations with the same predicate and concept into one listing their lifecycles
+	mergeLifecycles bool
 }
 
 func newLifecycleFilter(opts ...func(*lifecycleFilter)) *lifecycleFilter {
@@ -31,13 +35,28 @@ func withLifecycles(lifecycles []string) func(*lifecycleFilter) {
 	}
 }
 
+func withoutPrecedence() func(*lifecycleFilter) {
+	return func(f *lifecycleFilter) {
+		f.ignorePrecedence = true
+	}
+}
+
+func withMergedLifecycles() func(*lifecycleFilter) {
+	return func(f *lifecycleFilter) {
+		f.mergeLifecycles = true
+	}
+}
+
 func (f *lifecycleFilter) filter(annotations []annotation, chain *annotationsFilterChain) []annotation {
-	if containsPACLifecycle(annotations) {
-		filtered := filterPACAndV2Lifecycles(annotations)
-		return chain.doNext(f.applyAdditionalFiltering(filtered))
+	if !f.ignorePrecedence && containsPACLifecycle(annotations) {
+		annotations = filterPACAndV2Lifecycles(annotations)
+	}
+	annotations = f.applyAdditionalFiltering(annotations)
+	if f.mergeLifecycles {
+		annotations = mergeLifecycles(annotations)
 	}
 
-	return chain.doNext(f.applyAdditionalFiltering(annotations))
+	return chain.doNext(annotations)
 }
 
 func (f *lifecycleFilter) applyAdditionalFiltering(annotations []annotation) []annotation {
@@ -56,6 +75,37 @@ func (f *lifecycleFilter) applyAdditionalFiltering(annotations []annotation) []a
 	return filtered
 }
 
+// mergeLifecycles merges the annotations with the same predicate and concept into the first of them,
+// listing the lifecycles of the annotations merged with their provenance.
+func mergeLifecycles(annotations []annotation) []annotation {
+	var merged []annotation
+	index := map[string]int{}
+	for _, ann := range annotations {
+		lc := annotationLifecycle{Lifecycle: ann.Lifecycle, provenance: ann.Provenance}
+		key := ann.Predicate + "|" + ann.ID
+		i, ok := index[key]
+		if !ok {
+			ann.Lifecycles = []annotationLifecycle{lc}
+			index[key] = len(merged)
+			merged = append(merged, ann)
+			continue
+		}
+		if !containsLifecycle(merged[i].Lifecycles, ann.Lifecycle) {
+			merged[i].Lifecycles = append(merged[i].Lifecycles, lc)
+		}
+	}
+	return merged
+}
+
+func containsLifecycle(lifecycles []annotationLifecycle, lifecycle string) bool {
+	for _, lc := range lifecycles {
+		if lc.Lifecycle == lifecycle {
+			return true
+		}
+	}
+	return false
+}
+
 func containsPACLifecycle(annotations []annotation) bool {
 	for _, annotation := range annotations {
 		if annotation.Lifecycle == pacLifecycle {
@@ -254,3 +254,72 @@ func TestAdditionalFilteringNoPACAnnotations(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterWithoutPrecedence(t *testing.T) {
+	tests := map[string]struct {
+		lifecycles []string
+		expected   []annotation
+	}{
+		"all lifecycles should be returned alongside PAC": {
+			expected: []annotation{pacAnnotationA, v1AnnotationA, v2AnnotationA, nextVideoAnnotationA},
+		},
+		"the requested lifecycles should be returned alongside PAC": {
+			lifecycles: []string{"pac", "v1"},
+			expected:   []annotation{pacAnnotationA, v1AnnotationA},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			annotations := []annotation{pacAnnotationA, v1AnnotationA, v2AnnotationA, nextVideoAnnotationA}
+			f := newLifecycleFilter(withLifecycles(tc.lifecycles), withoutPrecedence())
+			chain := &annotationsFilterChain{filters: []annotationsFilter{f}}
+
+			assert.Equal(t, tc.expected, chain.doNext(annotations))
+		})
+	}
+}
+
+func TestFilterWithMergedLifecycles(t *testing.T) {
+	pacProvenance := provenance{AnnotatedBy: "http://api.ft.com/things/0edd3c31-1fd0-4ef6-9230-8d545be3880a", RelevanceScore: 0.8}
+	pacAbout := pacAnnotationA
+	pacAbout.Provenance = pacProvenance
+	v1About := v1AnnotationA
+	v1About.ID = pacAnnotationA.ID
+	v2About := v2AnnotationA
+	v2About.ID = pacAnnotationA.ID
+
+	tests := map[string]struct {
+		lifecycles []string
+		expected   []annotationLifecycle
+	}{
+		"every lifecycle should be merged": {
+			expected: []annotationLifecycle{
+				{Lifecycle: pacLifecycle, provenance: pacProvenance},
+				{Lifecycle: v1Lifecycle},
+				{Lifecycle: v2Lifecycle},
+			},
+		},
+		"the requested lifecycles should be merged": {
+			lifecycles: []string{"v1", "v2"},
+			expected:   []annotationLifecycle{{Lifecycle: v1Lifecycle}, {Lifecycle: v2Lifecycle}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			annotations := []annotation{pacAbout, v1About, pacAnnotationB, v2About, pacAbout}
+			f := newLifecycleFilter(withLifecycles(tc.lifecycles), withoutPrecedence(), withMergedLifecycles())
+			chain := &annotationsFilterChain{filters: []annotationsFilter{f}}
+			filtered := chain.doNext(annotations)
+
+			var merged []annotationLifecycle
+			for _, ann := range filtered {
+				if ann.ID == pacAnnotationA.ID {
+					merged = ann.Lifecycles
+				}
+			}
+			assert.Equal(t, tc.expected, merged)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package annotations
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	lastEventIDHeader = "Last-Event-ID"
+	// changesHeartbeatInterval keeps idle streams from being closed by proxies
+	changesHeartbeatInterval = 15 * time.Second
+)
+
+// changeData is the data of the events streamed for the changes of the annotations.
+type changeData struct {
+	UUID        string      `json:"uuid"`
+	Time        time.Time   `json:"time"`
+	Annotations interface{} `json:"annotations"`
+}
+
+// GetAnnotationsChanges streams the changes of the annotations as server-sent events, each with the new annotations
+// of a piece of content filtered by the filters of the changes route and with the fields requested,
+// skipping the changes that leave the filtered annotations unchanged. Clients resume the stream after the last event they
+// received with the Last-Event-ID header. The stream ends when the service starts shutting down.
+func GetAnnotationsChanges(hctx *HandlerCtx) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if hctx.changes == nil {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.WriteHeader(http.StatusNotImplemented)
+			msg := `{"message":"Annotations changes are not enabled"}`
+			if _, err := w.Write([]byte(msg)); err != nil {
+				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+			}
+			return
+		}
+
+		lifecycleParams := r.URL.Query()["lifecycle"]
+		err := validateLifecycleParams(lifecycleParams)
+		var filters []string
+		if err == nil {
+			filters, err = hctx.filterChain(changesRoute, r.URL.Query())
+		}
+		var fields fieldset
+		if err == nil {
+			fields, err = parseFields(r.URL.Query()["fields"])
+		}
+		if err == nil {
+			err = validateLastEventID(r.Header.Get(lastEventIDHeader))
+		}
+		if err != nil {
+			hctx.Log.WithError(err).Error("invalid request parameter")
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.WriteHeader(http.StatusBadRequest)
+			msg := `{"message":"invalid query parameter or Last-Event-ID header"}`
+			if _, err = w.Write([]byte(msg)); err != nil {
+				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+			}
+			return
+		}
+		if !hctx.allowFilterToggles(w, r) {
+			return
+		}
+		lastEventID, _ := strconv.ParseUint(r.Header.Get(lastEventIDHeader), 10, 64)
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+			w.WriteHeader(http.StatusInternalServerError)
+			msg := `{"message":"Streaming is not supported"}`
+			hctx.Log.Error(msg)
+			if _, err = w.Write([]byte(msg)); err != nil {
+				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		varyOnTier(w)
+		// prevents proxies from buffering the stream
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(changesHeartbeatInterval)
+		defer heartbeat.Stop()
+		tier := tierFromRequest(r)
+		for {
+			events, published := hctx.changes.changesSince(lastEventID)
+			for _, event := range events {
+				if err = writeChangeEvent(w, event, filters, filterRequest{lifecycles: lifecycleParams}, tier, fields); err != nil {
+					hctx.Log.WithError(err).WithUUID(event.UUID).Error("failed streaming annotations change")
+					return
+				}
+				lastEventID = event.ID
+			}
+			flusher.Flush()
+
+			select {
+			case <-published:
+			case <-heartbeat.C:
+				if _, err = w.Write([]byte(": heartbeat\n\n")); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			case <-hctx.shutdownSignal():
+				return
+			}
+		}
+	}
+}
+
+func validateLastEventID(lastEventID string) error {
+	if lastEventID == "" {
+		return nil
+	}
+	if _, err := strconv.ParseUint(lastEventID, 10, 64); err != nil {
+		return fmt.Errorf("invalid %s header: %s", lastEventIDHeader, lastEventID)
+	}
+	return nil
+}
+
+// writeChangeEvent writes the change unless the filters leave the annotations of the content unchanged.
+func writeChangeEvent(w http.ResponseWriter, event changeEvent, filters []string, req filterRequest, tier string, fields fieldset) error {
+	filter := func(anns []annotation) []annotation {
+		filtered := make([]annotation, len(anns))
+		copy(filtered, anns)
+		return applyFilters(filtered, filters, req)
+	}
+	anns := filter(event.Annotations)
+	if sameAnnotations(filter(event.Previous), anns) {
+		return nil
+	}
+	anns = restrictFields(anns, tier)
+	anns = expandFields(anns, nil)
+	if anns == nil {
+		anns = []annotation{}
+	}
+
+	data, err := json.Marshal(changeData{UUID: event.UUID, Time: event.Time, Annotations: renderView(anns, "", fields)})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: annotations\ndata: %s\n\n", event.ID, data)
+	return err
+}
@@ -0,0 +1,127 @@
+package annotations
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+// defaultChangesCapacity is how many changes a source keeps for the clients resuming the stream.
+const defaultChangesCapacity = 1000
+
+// changeSource provides the changes of the annotations streamed to the clients.
+type changeSource interface {
+	// changesSince returns the changes after the given event id, the oldest first,
+	// and a channel that is closed when further changes are available
+	changesSince(lastEventID uint64) ([]changeEvent, <-chan struct{})
+}
+
+// changeEvent holds the new annotations of a piece of content, identified by an increasing id.
+type changeEvent struct {
+	ID          uint64
+	UUID        string
+	Time        time.Time
+	Annotations []annotation
+	// Previous holds the annotations of the content before the change, so that the changes filtered out can be skipped
+	Previous []annotation
+}
+
+// memoryChangeSource keeps the latest changes in memory, the older ones cannot be resumed from.
+type memoryChangeSource struct {
+	mu        sync.Mutex
+	capacity  int
+	events    []changeEvent
+	lastID    uint64
+	published chan struct{}
+	// latest holds the annotations of the latest change of every piece of content, including those no longer kept
+	latest map[string][]annotation
+}
+
+func NewMemoryChangeSource(capacity int) *memoryChangeSource {
+	if capacity <= 0 {
+		capacity = defaultChangesCapacity
+	}
+	return &memoryChangeSource{capacity: capacity, published: make(chan struct{}), latest: make(map[string][]annotation)}
+}
+
+// record appends a change of the annotations of the content with an id greater than the previous ones,
+// unless they are the same as the latest change of the content, returning whether it was appended.
+func (s *memoryChangeSource) record(id uint64, contentUUID string, anns []annotation, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.latest[contentUUID]
+	if (!ok && len(anns) == 0) || (ok && sameAnnotations(previous, anns)) {
+		return false
+	}
+	s.latest[contentUUID] = anns
+	s.events = append(s.events, changeEvent{ID: id, UUID: contentUUID, Time: at, Annotations: anns, Previous: previous})
+	if len(s.events) > s.capacity {
+		s.events = append([]changeEvent(nil), s.events[len(s.events)-s.capacity:]...)
+	}
+	s.lastID = id
+	close(s.published)
+	s.published = make(chan struct{})
+	return true
+}
+
+func (s *memoryChangeSource) changesSince(lastEventID uint64) ([]changeEvent, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if lastEventID > s.lastID {
+		// the id comes from another source, e.g. before the changes file was replaced, so start over
+		lastEventID = 0
+	}
+	i := sort.Search(len(s.events), func(i int) bool { return s.events[i].ID > lastEventID })
+	events := make([]changeEvent, len(s.events)-i)
+	copy(events, s.events[i:])
+	return events, s.published
+}
+
+// fileChangeSource follows a JSON lines file where other processes append the changes of the annotations,
+// in the same format as the annotations history, e.g. the history file itself. The id of a change is its line number in the file,
+// and the lines holding the same annotations as the previous one of the content are skipped.
+type fileChangeSource struct {
+	memory *memoryChangeSource
+	file   *historyFile
+}
+
+// NewFileChangeSource reads the changes already in the file, which has to exist.
+// Watch has to be called for the source to follow the changes appended afterwards.
+func NewFileChangeSource(path string, capacity int, log *logger.UPPLogger) (*fileChangeSource, error) {
+	s := &fileChangeSource{memory: NewMemoryChangeSource(capacity), file: &historyFile{path: path, log: log}}
+	if err := s.poll(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileChangeSource) changesSince(lastEventID uint64) ([]changeEvent, <-chan struct{}) {
+	return s.memory.changesSince(lastEventID)
+}
+
+// Watch polls the file for new changes at the given interval until the context is done.
+func (s *fileChangeSource) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.poll(); err != nil {
+				s.file.log.WithError(err).Error("failed reading annotations changes")
+			}
+		}
+	}
+}
+
+func (s *fileChangeSource) poll() error {
+	return s.file.readAppended(func(number uint64, line historyLine) {
+		s.memory.record(number, line.UUID, line.annotations(), line.Time)
+	})
+}
@@ -0,0 +1,118 @@
+package annotations
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryChangeSource(t *testing.T) {
+	source := NewMemoryChangeSource(2)
+
+	events, published := source.changesSince(0)
+	assert.Empty(t, events)
+
+	assert.True(t, source.record(1, knownUUID, []annotation{historyFakebook}, historyStart))
+	select {
+	case <-published:
+	default:
+		t.Fatal("recording a change should be signalled")
+	}
+
+	assert.False(t, source.record(2, knownUUID, []annotation{historyFakebook}, historyStart.Add(time.Hour)), "unchanged annotations should be skipped")
+	assert.False(t, source.record(3, unknownUUID, nil, historyStart.Add(time.Hour)), "content without annotations should be skipped")
+	assert.True(t, source.record(4, unknownUUID, []annotation{historyMSJ}, historyStart.Add(time.Hour)))
+	assert.True(t, source.record(5, knownUUID, nil, historyStart.Add(2*time.Hour)))
+
+	events, _ = source.changesSince(0)
+	require.Len(t, events, 2, "only the latest changes should be kept")
+	assert.Equal(t, uint64(4), events[0].ID)
+	assert.Equal(t, unknownUUID, events[0].UUID)
+	assert.Equal(t, []annotation{historyMSJ}, events[0].Annotations)
+	assert.Empty(t, events[0].Previous)
+	assert.Equal(t, uint64(5), events[1].ID)
+	assert.Equal(t, []annotation{historyFakebook}, events[1].Previous, "the previous annotations of the content should be kept with the change")
+
+	events, _ = source.changesSince(4)
+	require.Len(t, events, 1)
+	assert.Equal(t, uint64(5), events[0].ID)
+
+	events, _ = source.changesSince(5)
+	assert.Empty(t, events)
+
+	events, _ = source.changesSince(42)
+	assert.Len(t, events, 2, "an unknown id should start over")
+}
+
+func TestFileChangeSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "annotations-changes")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "changes.jsonl")
+
+	line := func(contentUUID string, anns []annotation, at time.Time) []byte {
+		data, err := json.Marshal(newHistoryLine(contentUUID, anns, at))
+		require.NoError(t, err)
+		return append(data, '\n')
+	}
+	appendToFile := func(data []byte) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		require.NoError(t, err)
+		_, err = f.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	_, err = NewFileChangeSource(path, 0, logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+	assert.Error(t, err, "the file should exist")
+
+	appendToFile(line(knownUUID, []annotation{historyFakebook}, historyStart))
+	source, err := NewFileChangeSource(path, 0, logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+	require.NoError(t, err)
+
+	events, published := source.changesSince(0)
+	require.Len(t, events, 1, "the changes already in the file should be read")
+	assert.Equal(t, uint64(1), events[0].ID)
+	assert.Equal(t, knownUUID, events[0].UUID)
+	assert.True(t, historyStart.Equal(events[0].Time))
+	assert.Equal(t, []annotation{historyFakebook}, events[0].Annotations, "the lifecycles should be read")
+
+	next := line(unknownUUID, []annotation{historyMSJ}, historyStart.Add(time.Hour))
+	appendToFile([]byte("not json\n"))
+	appendToFile(next[:10])
+	require.NoError(t, source.poll())
+	events, _ = source.changesSince(1)
+	assert.Empty(t, events, "invalid and incomplete lines should not be streamed")
+
+	appendToFile(next[10:])
+	require.NoError(t, source.poll())
+	select {
+	case <-published:
+	default:
+		t.Fatal("a new change should be signalled")
+	}
+	events, _ = source.changesSince(1)
+	require.Len(t, events, 1)
+	assert.Equal(t, uint64(3), events[0].ID, "the id should be the line number")
+	assert.Equal(t, []annotation{historyMSJ}, events[0].Annotations)
+
+	appendToFile(line(knownUUID, []annotation{historyFakebook}, historyStart.Add(2*time.Hour)))
+	require.NoError(t, source.poll())
+	events, _ = source.changesSince(3)
+	assert.Empty(t, events, "the lines with the same annotations as the previous one of the content should be skipped")
+
+	require.NoError(t, ioutil.WriteFile(path, line(knownUUID, nil, historyStart.Add(3*time.Hour)), 0600))
+	require.NoError(t, source.poll())
+	events, _ = source.changesSince(4)
+	require.Len(t, events, 1, "a truncated file should be read from the start")
+	assert.Equal(t, uint64(5), events[0].ID)
+	assert.Empty(t, events[0].Annotations)
+	assert.Equal(t, []annotation{historyFakebook}, events[0].Previous)
+}
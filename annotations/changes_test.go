@@ -0,0 +1,154 @@
+package annotations
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAnnotationsChangesErrors(t *testing.T) {
+	tests := map[string]struct {
+		source             changeSource
+		query              string
+		lastEventID        string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		"changes not enabled": {
+			expectedStatusCode: http.StatusNotImplemented,
+			expectedBody:       `{"message":"Annotations changes are not enabled"}`,
+		},
+		"invalid lifecycle": {
+			source:             NewMemoryChangeSource(0),
+			query:              "?lifecycle=unknown",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"message":"invalid query parameter or Last-Event-ID header"}`,
+		},
+		"invalid fields": {
+			source:             NewMemoryChangeSource(0),
+			query:              "?fields=id,title",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"message":"invalid query parameter or Last-Event-ID header"}`,
+		},
+		"invalid Last-Event-ID": {
+			source:             NewMemoryChangeSource(0),
+			lastEventID:        "latest",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"message":"invalid query parameter or Last-Event-ID header"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var opts []func(*HandlerCtx)
+			if tc.source != nil {
+				opts = append(opts, WithChangeSource(tc.source))
+			}
+			hctx := NewHandlerCtx(mockDriver{}, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC"), opts...)
+
+			req := httptest.NewRequest("GET", "/content/annotations/changes"+tc.query, nil)
+			if tc.lastEventID != "" {
+				req.Header.Set(lastEventIDHeader, tc.lastEventID)
+			}
+			rec := httptest.NewRecorder()
+			GetAnnotationsChanges(hctx)(rec, req)
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			assert.JSONEq(t, tc.expectedBody, rec.Body.String())
+		})
+	}
+}
+
+func TestGetAnnotationsChanges(t *testing.T) {
+	source := NewMemoryChangeSource(0)
+	source.record(1, knownUUID, []annotation{historyFakebook, historyMSJ}, historyStart)
+	hctx := NewHandlerCtx(mockDriver{}, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC"), WithChangeSource(source))
+	server := httptest.NewServer(http.HandlerFunc(GetAnnotationsChanges(hctx)))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	resp, events := openChangesStream(ctx, t, server.URL+"?lifecycle=pac", "")
+	defer resp.Body.Close()
+
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+
+	event := events.next()
+	assert.Equal(t, "1", event["id"])
+	assert.Equal(t, "annotations", event["event"])
+	assert.JSONEq(t, fmt.Sprintf(`{"uuid":"%s","time":"2020-06-01T10:00:00Z","annotations":[{"predicate":"http://www.ft.com/ontology/annotation/about",
+		"id":"http://api.ft.com/things/5d1510f8-2779-4b74-adab-0a5eb138fca6","apiUrl":"",
+		"types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/organisation/Organisation"],
+		"prefLabel":"The Mall Street Journal"}]}`, knownUUID), event["data"], "the annotations should be filtered by lifecycle")
+
+	source.record(2, unknownUUID, []annotation{historyFakebook}, historyStart.Add(time.Hour))
+	source.record(3, knownUUID, []annotation{historyFakebook}, historyStart.Add(2*time.Hour))
+	event = events.next()
+	assert.Equal(t, "3", event["id"], "the changes leaving the filtered annotations unchanged should be skipped")
+	assert.JSONEq(t, fmt.Sprintf(`{"uuid":"%s","time":"2020-06-01T12:00:00Z","annotations":[]}`, knownUUID), event["data"],
+		"the changes removing all annotations should be streamed")
+
+	resumed, resumedEvents := openChangesStream(ctx, t, server.URL, "1")
+	defer resumed.Body.Close()
+	event = resumedEvents.next()
+	assert.Equal(t, "2", event["id"], "the stream should resume after the last event id")
+	assert.Contains(t, event["data"], "Fakebook, Inc.")
+
+	projected, projectedEvents := openChangesStream(ctx, t, server.URL+"?fields=id,prefLabel", "1")
+	defer projected.Body.Close()
+	event = projectedEvents.next()
+	assert.JSONEq(t, fmt.Sprintf(`{"uuid":"%s","time":"2020-06-01T11:00:00Z","annotations":[
+		{"id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400","prefLabel":"Fakebook, Inc."}]}`, unknownUUID), event["data"],
+		"only the fields requested should be streamed")
+
+	hctx.MarkShuttingDown()
+	_, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err, "the stream should end when shutting down")
+}
+
+type sseReader struct {
+	t      *testing.T
+	reader *bufio.Reader
+}
+
+// next reads the fields of the next event, skipping the comments.
+func (r sseReader) next() map[string]string {
+	event := map[string]string{}
+	for {
+		line, err := r.reader.ReadString('\n')
+		require.NoError(r.t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" && len(event) > 0 {
+			return event
+		}
+		if line == "" || strings.HasPrefix(line, ":") {
+			continue
+		}
+		parts := strings.SplitN(line, ": ", 2)
+		require.Len(r.t, parts, 2)
+		event[parts[0]] = parts[1]
+	}
+}
+
+func openChangesStream(ctx context.Context, t *testing.T, url string, lastEventID string) (*http.Response, sseReader) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set(lastEventIDHeader, lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	return resp, sseReader{t: t, reader: bufio.NewReader(resp.Body)}
+}
@@ -0,0 +1,73 @@
+package annotations
+
+import (
+	"sync"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// coalescingDriver wraps a driver so that concurrent reads of the same content with the same options
+// share a single neo4j query instead of each running their own.
+type coalescingDriver struct {
+	driver
+
+	mu       sync.Mutex
+	inFlight map[string]*inFlightRead
+
+	executed  metrics.Counter
+	coalesced metrics.Counter
+}
+
+type inFlightRead struct {
+	wg     sync.WaitGroup
+	result readResult
+	err    error
+}
+
+func NewCoalescingDriver(d driver, registry metrics.Registry) *coalescingDriver {
+	return &coalescingDriver{
+		driver:    d,
+		inFlight:  make(map[string]*inFlightRead),
+		executed:  metrics.GetOrRegisterCounter("annotations.read.executed", registry),
+		coalesced: metrics.GetOrRegisterCounter("annotations.read.coalesced", registry),
+	}
+}
+
+func (cd *coalescingDriver) read(contentUUID string, opts readOptions) (readResult, error) {
+	key := contentUUID + "|" + opts.key()
+
+	cd.mu.Lock()
+	if call, ok := cd.inFlight[key]; ok {
+		cd.mu.Unlock()
+		cd.coalesced.Inc(1)
+		call.wg.Wait()
+		return copyResult(call.result), call.err
+	}
+
+	call := &inFlightRead{}
+	call.wg.Add(1)
+	cd.inFlight[key] = call
+	cd.mu.Unlock()
+
+	defer func() {
+		cd.mu.Lock()
+		delete(cd.inFlight, key)
+		cd.mu.Unlock()
+		call.wg.Done()
+	}()
+
+	cd.executed.Inc(1)
+	call.result, call.err = cd.driver.read(contentUUID, opts)
+	return copyResult(call.result), call.err
+}
+
+// copyResult gives every waiter its own annotations slice, so the filters applied by one request
+// cannot affect the result handed to another.
+func copyResult(result readResult) readResult {
+	if result.anns != nil {
+		anns := make(annotations, len(result.anns))
+		copy(anns, result.anns)
+		result.anns = anns
+	}
+	return result
+}
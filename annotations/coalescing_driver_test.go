@@ -0,0 +1,106 @@
+package annotations
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoalescingDriverSharesConcurrentReads(t *testing.T) {
+	const waiters = 10
+	var calls int32
+	release := make(chan struct{})
+
+	d := mockDriver{
+		readFunc: func(string, readOptions) (readResult, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return readResult{anns: annotations{{ID: "1", Predicate: "foo"}}, found: true}, nil
+		},
+	}
+	registry := metrics.NewRegistry()
+	cd := NewCoalescingDriver(d, registry)
+
+	var wg sync.WaitGroup
+	results := make([]annotations, waiters)
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := cd.read(knownUUID, defaultReadOptions(cd))
+			assert.NoError(t, err)
+			assert.True(t, result.found)
+			results[i] = result.anns
+		}(i)
+	}
+
+	// wait until every request has either started the query or joined it
+	for {
+		executed := metrics.GetOrRegisterCounter("annotations.read.executed", registry).Count()
+		coalesced := metrics.GetOrRegisterCounter("annotations.read.coalesced", registry).Count()
+		if executed+coalesced == waiters {
+			break
+		}
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls, "only one read should reach the driver")
+	assert.Equal(t, int64(waiters-1), metrics.GetOrRegisterCounter("annotations.read.coalesced", registry).Count())
+	for _, anns := range results {
+		assert.Equal(t, annotations{{ID: "1", Predicate: "foo"}}, anns)
+	}
+}
+
+func TestCoalescingDriverDoesNotShareSequentialReads(t *testing.T) {
+	var calls int32
+	d := mockDriver{
+		readFunc: func(string, readOptions) (readResult, error) {
+			atomic.AddInt32(&calls, 1)
+			return readResult{anns: annotations{}, found: true}, nil
+		},
+	}
+	cd := NewCoalescingDriver(d, metrics.NewRegistry())
+
+	_, err := cd.read(knownUUID, defaultReadOptions(cd))
+	assert.NoError(t, err)
+	_, err = cd.read(knownUUID, defaultReadOptions(cd))
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(2), calls)
+}
+
+func TestCoalescingDriverDoesNotShareReadsWithDifferentOptions(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	d := mockDriver{
+		readFunc: func(string, readOptions) (readResult, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return readResult{anns: annotations{}, found: true}, nil
+		},
+	}
+	cd := NewCoalescingDriver(d, metrics.NewRegistry())
+
+	var wg sync.WaitGroup
+	for _, opts := range []readOptions{defaultReadOptions(cd), {}} {
+		wg.Add(1)
+		go func(opts readOptions) {
+			defer wg.Done()
+			_, err := cd.read(knownUUID, opts)
+			assert.NoError(t, err)
+		}(opts)
+	}
+	for atomic.LoadInt32(&calls) < 2 {
+		runtime.Gosched()
+	}
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(2), calls)
+}
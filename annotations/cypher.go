@@ -2,44 +2,196 @@ package annotations
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"errors"
 
+	"github.com/Financial-Times/go-logger/v2"
 	"github.com/Financial-Times/neo-model-utils-go/mapper"
 	"github.com/Financial-Times/neo-utils-go/v2/neoutils"
 	"github.com/jmcvetta/neoism"
+	"github.com/rcrowley/go-metrics"
 )
 
 // Driver interface
 type driver interface {
-	read(id string) (anns annotations, found bool, err error)
+	read(id string, opts readOptions) (readResult, error)
+	related(id string, concepts []conceptWeight, limit int) ([]relatedContent, error)
 	checkConnectivity() error
+	missingIndexes() ([]string, error)
+	// implicitDerivations names the implicit derivations the driver runs, in order
+	implicitDerivations() []string
 }
 
+// requiredIndexes lists the neo4j indexes the annotations queries rely on to avoid full scans,
+// as described by db.indexes().
+var requiredIndexes = []string{
+	"INDEX ON :Content(uuid)",
+	"INDEX ON :Concept(prefUUID)",
+}
+
+const (
+	defaultDerivationTimeout = 5 * time.Second
+	defaultMaxDepth          = 10
+	// relatedCandidatesPerConcept bounds how many pieces of content annotated with each concept are scored by the related query,
+	// the most recently published first, so that widely used concepts do not make it score most of the content
+	relatedCandidatesPerConcept = 1000
+)
+
 // CypherDriver struct
 type cypherDriver struct {
 	conn neoutils.NeoConnection
 	env  string
+	// derivations are the queries run by every read, the explicit one first
+	derivations []derivation
+	// derivationTimeout is how long a read waits for the implicit derivations before serving the annotations without them
+	derivationTimeout time.Duration
+	// maxDepths overrides the default maximum traversal depth of derivations keyed by derivation name
+	maxDepths map[string]int
+	// log reports the rows dropped because they could not be mapped to annotations, when set
+	log *logger.UPPLogger
+	// registry holds the meters of the dropped rows, the default registry when not set
+	registry metrics.Registry
+}
+
+func NewCypherDriver(conn neoutils.NeoConnection, env string, opts ...func(*cypherDriver)) cypherDriver {
+	cd := cypherDriver{
+		conn:              conn,
+		env:               env,
+		derivations:       defaultDerivations,
+		derivationTimeout: defaultDerivationTimeout,
+		maxDepths:         map[string]int{},
+	}
+	for _, opt := range opts {
+		opt(&cd)
+	}
+
+	return cd
 }
 
-func NewCypherDriver(conn neoutils.NeoConnection, env string) cypherDriver {
-	return cypherDriver{conn, env}
+func WithDerivationTimeout(timeout time.Duration) func(*cypherDriver) {
+	return func(cd *cypherDriver) {
+		cd.derivationTimeout = timeout
+	}
+}
+
+// WithDerivationRules runs the derivations compiled from the rules loaded by LoadDerivationRules instead of the default ones.
+func WithDerivationRules(derivations []derivation) func(*cypherDriver) {
+	return func(cd *cypherDriver) {
+		cd.derivations = derivations
+	}
+}
+
+// WithLogger logs the rows of the queries that are dropped because they cannot be mapped to annotations.
+func WithLogger(log *logger.UPPLogger) func(*cypherDriver) {
+	return func(cd *cypherDriver) {
+		cd.log = log
+	}
+}
+
+// WithMetricsRegistry registers the meters of the dropped rows in the given registry.
+func WithMetricsRegistry(registry metrics.Registry) func(*cypherDriver) {
+	return func(cd *cypherDriver) {
+		cd.registry = registry
+	}
+}
+
+// WithMaxDepth limits how deep the named derivation traverses its hierarchy.
+// A depth of 0 keeps the maximum depth of the derivation rule.
+func WithMaxDepth(derivation string, depth int) func(*cypherDriver) {
+	return func(cd *cypherDriver) {
+		if depth > 0 {
+			cd.maxDepths[derivation] = depth
+		}
+	}
+}
+
+func (cd cypherDriver) implicitDerivations() []string {
+	var names []string
+	for _, d := range cd.derivations {
+		if d.implicit {
+			names = append(names, d.name)
+		}
+	}
+	return names
+}
+
+// CheckMaxDepth returns an error unless the derivations of the driver include the named one traversing a hierarchy,
+// the depth of which can be limited with WithMaxDepth.
+func (cd cypherDriver) CheckMaxDepth(derivationName string) error {
+	for _, d := range cd.derivations {
+		if d.name != derivationName {
+			continue
+		}
+		if d.maxDepth == 0 {
+			return fmt.Errorf("derivation %q does not traverse a hierarchy", derivationName)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown derivation %q", derivationName)
 }
 
 func (cd cypherDriver) checkConnectivity() error {
 	return neoutils.Check(cd.conn)
 }
 
+// missingIndexes returns the required indexes that are not present or not online.
+func (cd cypherDriver) missingIndexes() ([]string, error) {
+	var results []struct {
+		Description string
+		State       string
+	}
+	query := &neoism.CypherQuery{
+		Statement: `CALL db.indexes() YIELD description, state RETURN description, state`,
+		Result:    &results,
+	}
+	if err := cd.conn.CypherBatch([]*neoism.CypherQuery{query}); err != nil {
+		return nil, fmt.Errorf("failed listing neo4j indexes: %w", err)
+	}
+
+	online := make(map[string]bool)
+	for _, r := range results {
+		if r.State == "ONLINE" {
+			online[r.Description] = true
+		}
+	}
+
+	var missing []string
+	for _, index := range requiredIndexes {
+		if !online[index] {
+			missing = append(missing, index)
+		}
+	}
+	return missing, nil
+}
+
 type neoAnnotation struct {
 	Predicate    string
 	ID           string
 	APIURL       string
 	Types        []string
 	LeiCode      string
-	FIGI         string
+	Instruments  []neoInstrument
 	PrefLabel    string
 	Lifecycle    string
 	IsDeprecated bool
+	Depth        int
+
+	// Provenance of explicit annotations
+	AnnotatedBy     string
+	AnnotatedDate   string
+	RelevanceScore  float64
+	ConfidenceScore float64
+
+	// Concept details
+	Aliases        []string
+	DescriptionXML string
+	ImageURL       string
+	Strapline      string
+	ScopeNote      string
 
 	// Canonical information
 	PrefUUID           string
@@ -54,13 +206,36 @@ type neoAnnotation struct {
 	PlatformVersion string   `json:"platformVersion,omitempty"`
 }
 
-func (cd cypherDriver) read(contentUUID string) (anns annotations, found bool, err error) {
-	var results []neoAnnotation
+type neoInstrument struct {
+	FIGI     string
+	Ticker   string
+	Exchange string
+	Primary  bool
+}
 
-	query := &neoism.CypherQuery{
-		Statement: `
+// derivation is one of the queries whose results are merged into the annotations of a piece of content.
+// Implicit derivations are allowed to fail, in which case the annotations are served without their results.
+type derivation struct {
+	name     string
+	implicit bool
+	// statement of derivations traversing a hierarchy is formatted with the maximum depth of the traversal
+	statement string
+	// maxDepth is the default maximum depth of the traversal, 0 for derivations not traversing a hierarchy
+	maxDepth int
+	// minDepth is the lowest maximum depth the traversal pattern of the statement accepts
+	minDepth int
+	// concept is the variable of the canonical concept returned by the statement
+	concept string
+}
+
+// explicitDerivation reads the annotations of the content, the implicit derivations are compiled from the derivation rules.
+var explicitDerivation = derivation{
+	name:    "explicit",
+	concept: "canonicalConcept",
+	statement: `
 		MATCH (content:Content{uuid:{contentUUID}})-[rel]-(:Concept)-[:EQUIVALENT_TO]->(canonicalConcept:Concept)
-		OPTIONAL MATCH (canonicalConcept)<-[:EQUIVALENT_TO]-(:Concept)<-[:ISSUED_BY]-(figi:FinancialInstrument)
+		OPTIONAL MATCH (canonicalConcept)<-[:EQUIVALENT_TO]-(:Concept)<-[:ISSUED_BY]-(fi:FinancialInstrument)
+		WITH rel, canonicalConcept, collect(fi) as issued
 		RETURN
 			canonicalConcept.prefUUID as id,
 			canonicalConcept.isDeprecated as isDeprecated,
@@ -68,73 +243,336 @@ func (cd cypherDriver) read(contentUUID string) (anns annotations, found bool, e
 			labels(canonicalConcept) as types,
 			canonicalConcept.prefLabel as prefLabel,
 			canonicalConcept.leiCode as leiCode,
-			figi.figiCode as figi,
-			rel.lifecycle as lifecycle
-		UNION ALL
-		MATCH (content:Content{uuid:{contentUUID}})-[rel]-(:Concept)-[:EQUIVALENT_TO]->(canonicalBrand:Brand)
-		OPTIONAL MATCH (canonicalBrand)-[:EQUIVALENT_TO]-(leafBrand:Brand)-[r:HAS_PARENT*0..]->(parentBrand:Brand)-[:EQUIVALENT_TO]->(canonicalParent:Brand)
-		RETURN 
-			DISTINCT canonicalParent.prefUUID as id,
-			canonicalParent.isDeprecated as isDeprecated,
-			"IMPLICITLY_CLASSIFIED_BY" as predicate,
-			labels(canonicalParent) as types,
-			canonicalParent.prefLabel as prefLabel,
-			null as leiCode,
-			null as figi,
-			rel.lifecycle as lifecycle
-		UNION ALL
-		MATCH (content:Content{uuid:{contentUUID}})-[rel:ABOUT]-(:Concept)-[:EQUIVALENT_TO]->(canonicalConcept:Concept)
-		MATCH (canonicalConcept)<-[:EQUIVALENT_TO]-(leafConcept:Topic)<-[:IMPLIED_BY*1..]-(impliedByBrand:Brand)-[:EQUIVALENT_TO]->(canonicalBrand:Brand)
-		RETURN 
-			DISTINCT canonicalBrand.prefUUID as id,
-			canonicalBrand.isDeprecated as isDeprecated,
-			"IMPLICITLY_CLASSIFIED_BY" as predicate,
-			labels(canonicalBrand) as types,
-			canonicalBrand.prefLabel as prefLabel,
-			null as leiCode,
-			null as figi,
-			rel.lifecycle as lifecycle
-		UNION ALL
-		MATCH (content:Content{uuid:{contentUUID}})-[rel:ABOUT]-(:Concept)-[:EQUIVALENT_TO]->(canonicalConcept:Concept)
-		MATCH (canonicalConcept)<-[:EQUIVALENT_TO]-(leafConcept:Concept)-[:HAS_BROADER*1..]->(implicit:Concept)-[:EQUIVALENT_TO]->(canonicalImplicit)
-		WHERE NOT (canonicalImplicit)<-[:EQUIVALENT_TO]-(:Concept)<-[:ABOUT]-(content) // filter out the original abouts
-		RETURN 
-			DISTINCT canonicalImplicit.prefUUID as id,
-			canonicalImplicit.isDeprecated as isDeprecated,
-			"IMPLICITLY_ABOUT" as predicate,
-			labels(canonicalImplicit) as types,
-			canonicalImplicit.prefLabel as prefLabel,
-			null as leiCode,
-			null as figi,
+			[fi IN issued | {figi: fi.figiCode, ticker: fi.ticker, exchange: fi.exchange, primary: fi.isPrimaryListing}] as instruments,
 			rel.lifecycle as lifecycle
 		`,
-		Parameters: neoism.Props{"contentUUID": contentUUID},
-		Result:     &results,
-	}
+}
 
-	err = cd.conn.CypherBatch([]*neoism.CypherQuery{query})
+// defaultDerivations are compiled from the default derivation rules, the explicit one first.
+var defaultDerivations = mustCompileDerivations(defaultDerivationRules)
 
+func mustCompileDerivations(rules []DerivationRule) []derivation {
+	compiled, err := compileDerivations(rules)
 	if err != nil {
-		return annotations{}, false,
-			fmt.Errorf("failed looking up annotations for %s with query %s: %w", contentUUID, query.Statement, err)
+		panic(err)
+	}
+	return compiled
+}
+
+// readOptions selects what a read derives besides the explicit annotations.
+type readOptions struct {
+	// derivations names the implicit derivations to run
+	derivations []string
+	// maxDepths lowers the maximum traversal depth of derivations keyed by derivation name
+	maxDepths map[string]int
+	// conceptDetails also reads the aliases, description, image, strapline and scope note of the concepts
+	conceptDetails bool
+	// provenance also reads who annotated the content with the concepts and the scores of the explicit annotations
+	provenance bool
+}
+
+// defaultReadOptions runs every implicit derivation of the driver.
+func defaultReadOptions(d driver) readOptions {
+	return readOptions{derivations: d.implicitDerivations()}
+}
+
+func (o readOptions) includes(d derivation) bool {
+	if !d.implicit {
+		return true
+	}
+	for _, name := range o.derivations {
+		if name == d.name {
+			return true
+		}
 	}
+	return false
+}
+
+// key identifies the options, so that reads with the same options can share their results.
+func (o readOptions) key() string {
+	names := append([]string(nil), o.derivations...)
+	sort.Strings(names)
 
-	if (len(results)) == 0 {
-		return annotations{}, false, nil
+	var depths []string
+	for name, depth := range o.maxDepths {
+		depths = append(depths, fmt.Sprintf("%s=%d", name, depth))
+	}
+	sort.Strings(depths)
+	return strings.Join(names, ",") + "|" + strings.Join(depths, ",") + "|" + strconv.FormatBool(o.conceptDetails) + "|" + strconv.FormatBool(o.provenance)
+}
+
+// complete tells whether the options read the annotations as the default ones, every derivation at its full depth.
+func (o readOptions) complete(defaults readOptions) bool {
+	return o.key() == defaults.key()
+}
+
+// readResult holds the annotations read for a piece of content.
+type readResult struct {
+	anns  annotations
+	found bool
+	// missingDerivations names the implicit derivations that failed or timed out,
+	// so the annotations are served without their results.
+	missingDerivations []string
+	// dropped lists the rows that could not be mapped to annotations.
+	dropped []droppedAnnotation
+}
+
+type derivationResult struct {
+	results []neoAnnotation
+	err     error
+}
+
+// read runs every selected derivation as its own query concurrently and merges their results in the order of the derivations.
+// A failure of the explicit annotations query fails the read, while implicit derivations that fail
+// or do not complete within the derivation timeout are reported as missing.
+func (cd cypherDriver) read(contentUUID string, opts readOptions) (readResult, error) {
+	var selected []derivation
+	for _, d := range cd.derivations {
+		if opts.includes(d) {
+			selected = append(selected, d)
+		}
+	}
+
+	pending := make([]chan derivationResult, len(selected))
+	for i, d := range selected {
+		pending[i] = make(chan derivationResult, 1)
+		go func(d derivation, done chan<- derivationResult) {
+			var results []neoAnnotation
+			query := &neoism.CypherQuery{
+				Statement:  cd.statement(d, opts),
+				Parameters: neoism.Props{"contentUUID": contentUUID},
+				Result:     &results,
+			}
+			err := cd.conn.CypherBatch([]*neoism.CypherQuery{query})
+			if err != nil {
+				err = fmt.Errorf("failed looking up %s annotations for %s with query %s: %w", d.name, contentUUID, query.Statement, err)
+			}
+			done <- derivationResult{results: results, err: err}
+		}(d, pending[i])
+	}
+
+	expired := make(chan struct{})
+	timer := time.AfterFunc(cd.derivationTimeout, func() { close(expired) })
+	defer timer.Stop()
+
+	var results []neoAnnotation
+	var missing []string
+	for i, d := range selected {
+		if !d.implicit {
+			res := <-pending[i]
+			if res.err != nil {
+				return readResult{}, res.err
+			}
+			results = append(results, res.results...)
+			continue
+		}
+
+		res, completed := awaitDerivation(pending[i], expired)
+		if !completed || res.err != nil {
+			cd.reportMissing(contentUUID, d.name, res.err)
+			missing = append(missing, d.name)
+			continue
+		}
+		results = append(results, res.results...)
 	}
 
 	var mappedAnnotations []annotation
-	found = false
+	var dropped []droppedAnnotation
+	found := false
 
 	for idx := range results {
 		annotation, err := mapToResponseFormat(results[idx], cd.env)
-		if err == nil {
-			found = true
-			mappedAnnotations = append(mappedAnnotations, annotation)
+		if err != nil {
+			var mappingErr *mappingError
+			if errors.As(err, &mappingErr) {
+				dropped = append(dropped, cd.reportDropped(contentUUID, mappingErr))
+			}
+			continue
+		}
+		found = true
+		mappedAnnotations = append(mappedAnnotations, annotation)
+	}
+
+	return readResult{anns: mappedAnnotations, found: found, missingDerivations: missing, dropped: dropped}, nil
+}
+
+// reportMissing logs an implicit derivation left out of the annotations, with the error it failed with if it did not time out.
+func (cd cypherDriver) reportMissing(contentUUID string, derivationName string, err error) {
+	if cd.log == nil {
+		return
+	}
+	entry := cd.log.WithUUID(contentUUID).WithField("derivation", derivationName)
+	if err != nil {
+		entry.WithError(err).Error("Failed looking up implicit annotations")
+		return
+	}
+	entry.Warn("Timed out looking up implicit annotations")
+}
+
+// reportDropped logs and meters a row that could not be mapped, by reason.
+func (cd cypherDriver) reportDropped(contentUUID string, err *mappingError) droppedAnnotation {
+	metrics.GetOrRegisterMeter("annotations.mapping.dropped."+err.dropped.Reason, cd.registry).Mark(1)
+	if cd.log != nil {
+		cd.log.WithUUID(contentUUID).
+			WithField("reason", err.dropped.Reason).
+			WithField("conceptId", err.dropped.ConceptID).
+			WithField("relationship", err.dropped.Relationship).
+			WithError(err).
+			Warn("Dropped annotation that could not be mapped")
+	}
+	return err.dropped
+}
+
+type neoRelatedContent struct {
+	UUID   string
+	Types  []string
+	Score  float64
+	Shared []neoSharedConcept
+}
+
+type neoSharedConcept struct {
+	ID        string
+	Types     []string
+	PrefLabel string
+	Weight    float64
+}
+
+// relatedStatement finds the other content annotated with the given canonical concepts, keeping the most recently published
+// candidates of each concept. Each shared concept weighs its weight for the given content times the weight of the strongest relationship
+// annotating the other content with it, and the other content is scored by the sum of the weights of its shared concepts.
+var relatedStatement = fmt.Sprintf(`
+		UNWIND {concepts} as concept
+		MATCH (other:Content)-[rel:%s]->(:Concept)-[:EQUIVALENT_TO]->(canonical:Concept{prefUUID:concept.id})
+		WHERE other.uuid <> {contentUUID}
+		WITH other, canonical, concept, max(%s) as relWeight
+		ORDER BY coalesce(other.publishedDateEpoch, 0) DESC, other.uuid
+		WITH canonical, concept, collect({other: other, relWeight: relWeight})[..{candidates}] as candidates
+		UNWIND candidates as candidate
+		WITH candidate.other as other, canonical, concept.weight * candidate.relWeight as weight
+		ORDER BY weight DESC, canonical.prefUUID
+		WITH other, sum(weight) as score, collect({id: canonical.prefUUID, types: labels(canonical), prefLabel: canonical.prefLabel, weight: weight}) as shared
+		RETURN other.uuid as uuid, labels(other) as types, score, shared
+		ORDER BY score DESC, uuid
+		LIMIT {limit}
+		`, strings.Join(relatedRelationships(), "|"), relatedWeightCase("rel"))
+
+// related returns up to limit pieces of content sharing the weighted concepts with the given one, the most related first.
+func (cd cypherDriver) related(contentUUID string, concepts []conceptWeight, limit int) ([]relatedContent, error) {
+	var results []neoRelatedContent
+	query := &neoism.CypherQuery{
+		Statement: relatedStatement,
+		Parameters: neoism.Props{
+			"contentUUID": contentUUID,
+			"concepts":    concepts,
+			"candidates":  relatedCandidatesPerConcept,
+			"limit":       limit,
+		},
+		Result: &results,
+	}
+	if err := cd.conn.CypherBatch([]*neoism.CypherQuery{query}); err != nil {
+		return nil, fmt.Errorf("failed looking up content related to %s with query %s: %w", contentUUID, query.Statement, err)
+	}
+
+	related := make([]relatedContent, 0, len(results))
+	for _, res := range results {
+		rc := relatedContent{
+			ID:     mapper.IDURL(res.UUID),
+			APIURL: mapper.APIURL(res.UUID, res.Types, cd.env),
+			Score:  res.Score,
+		}
+		for _, sc := range res.Shared {
+			rc.SharedConcepts = append(rc.SharedConcepts, sharedConcept{
+				ID:        mapper.IDURL(sc.ID),
+				APIURL:    mapper.APIURL(sc.ID, sc.Types, cd.env),
+				Types:     mapper.TypeURIs(sc.Types),
+				PrefLabel: sc.PrefLabel,
+				Weight:    sc.Weight,
+			})
 		}
+		related = append(related, rc)
 	}
+	return related, nil
+}
+
+// statement returns the query of the derivation, limiting the depth of its traversal to the configured maximum
+// or to the one requested by the read options if that is lower.
+func (cd cypherDriver) statement(d derivation, opts readOptions) string {
+	stmt := d.statement
+	if opts.conceptDetails {
+		stmt = strings.Replace(stmt, "RETURN", "RETURN"+conceptDetailsColumns(d.concept), 1)
+	}
+	if opts.provenance && !d.implicit {
+		stmt = strings.Replace(stmt, "RETURN", "RETURN"+provenanceColumns, 1)
+	}
+	if d.maxDepth == 0 {
+		return stmt
+	}
+
+	depth := d.maxDepth
+	if configured, ok := cd.maxDepths[d.name]; ok {
+		depth = configured
+	}
+	if requested, ok := opts.maxDepths[d.name]; ok && requested < depth {
+		depth = requested
+	}
+	if depth < d.minDepth {
+		depth = d.minDepth
+	}
+	return fmt.Sprintf(stmt, depth)
+}
+
+// conceptDetailsColumns returns the columns reading the details of the given concept variable.
+func conceptDetailsColumns(concept string) string {
+	return fmt.Sprintf(`
+			%[1]s.aliases as aliases,
+			%[1]s.descriptionXML as descriptionXML,
+			%[1]s.imageUrl as imageUrl,
+			%[1]s.strapline as strapline,
+			%[1]s.scopeNote as scopeNote,`, concept)
+}
+
+// provenanceColumns reads the provenance of the annotations from the rel relationship of the explicit derivation.
+const provenanceColumns = `
+			rel.annotatedBy as annotatedBy,
+			rel.annotatedDate as annotatedDate,
+			rel.relevanceScore as relevanceScore,
+			rel.confidenceScore as confidenceScore,`
+
+// awaitDerivation waits for the result of a derivation until the deadline expires,
+// always preferring a result that is already available over an expired deadline.
+func awaitDerivation(pending <-chan derivationResult, expired <-chan struct{}) (derivationResult, bool) {
+	select {
+	case res := <-pending:
+		return res, true
+	default:
+	}
+
+	select {
+	case res := <-pending:
+		return res, true
+	case <-expired:
+		return derivationResult{}, false
+	}
+}
 
-	return mappedAnnotations, found, nil
+// Reasons of the rows dropped by mapToResponseFormat.
+const (
+	droppedUnknownType      = "unknownType"
+	droppedUnknownPredicate = "unknownPredicate"
+)
+
+// mappingError describes a row of the annotations queries that cannot be mapped to an annotation.
+type mappingError struct {
+	dropped droppedAnnotation
+	err     error
+}
+
+func (e *mappingError) Error() string {
+	return e.err.Error()
+}
+
+func (e *mappingError) Unwrap() error {
+	return e.err
 }
 
 func mapToResponseFormat(neoAnn neoAnnotation, env string) (annotation, error) {
@@ -142,26 +580,76 @@ func mapToResponseFormat(neoAnn neoAnnotation, env string) (annotation, error) {
 
 	ann.PrefLabel = neoAnn.PrefLabel
 	ann.LeiCode = neoAnn.LeiCode
-	ann.FIGI = neoAnn.FIGI
+	ann.Instruments = mapInstruments(neoAnn.Instruments)
+	ann.FIGI = primaryFIGI(ann.Instruments)
 	ann.APIURL = mapper.APIURL(neoAnn.ID, neoAnn.Types, env)
 	ann.ID = mapper.IDURL(neoAnn.ID)
+	dropped := droppedAnnotation{ConceptID: ann.ID, Relationship: neoAnn.Predicate}
 	types := mapper.TypeURIs(neoAnn.Types)
 	if types == nil || len(types) == 0 {
-		return ann, fmt.Errorf("could not map type URIs for ID %s with types %s: concept not found", ann.ID, ann.Types)
+		dropped.Reason = droppedUnknownType
+		return ann, &mappingError{dropped: dropped, err: fmt.Errorf("could not map type URIs for ID %s with types %s: concept not found", ann.ID, neoAnn.Types)}
 	}
 	ann.Types = types
 
 	predicate, err := getPredicateFromRelationship(neoAnn.Predicate)
 	if err != nil {
-		return ann, fmt.Errorf("could not find predicate for ID %s for relationship %s: %w", ann.ID, ann.Predicate, err)
+		dropped.Reason = droppedUnknownPredicate
+		return ann, &mappingError{dropped: dropped, err: fmt.Errorf("could not find predicate for ID %s for relationship %s: %w", ann.ID, neoAnn.Predicate, err)}
 	}
 	ann.Predicate = predicate
 	ann.Lifecycle = neoAnn.Lifecycle
 	ann.IsDeprecated = neoAnn.IsDeprecated
+	ann.Depth = neoAnn.Depth
+	ann.Aliases = neoAnn.Aliases
+	ann.DescriptionXML = neoAnn.DescriptionXML
+	ann.ImageURL = neoAnn.ImageURL
+	ann.Strapline = neoAnn.Strapline
+	ann.ScopeNote = neoAnn.ScopeNote
+	ann.Provenance = provenance{
+		AnnotatedDate:   neoAnn.AnnotatedDate,
+		RelevanceScore:  neoAnn.RelevanceScore,
+		ConfidenceScore: neoAnn.ConfidenceScore,
+	}
+	if neoAnn.AnnotatedBy != "" {
+		ann.Provenance.AnnotatedBy = mapper.IDURL(neoAnn.AnnotatedBy)
+	}
 
 	return ann, nil
 }
 
+// mapInstruments returns the instruments sorted by FIGI without duplicates.
+// An instrument is flagged as the primary listing when the graph says so, or when it is the only one issued.
+func mapInstruments(neoInstruments []neoInstrument) []instrument {
+	seen := map[string]bool{}
+	var instruments []instrument
+	for _, fi := range neoInstruments {
+		if fi.FIGI == "" || seen[fi.FIGI] {
+			continue
+		}
+		seen[fi.FIGI] = true
+		instruments = append(instruments, instrument{FIGI: fi.FIGI, Ticker: fi.Ticker, Exchange: fi.Exchange, Primary: fi.Primary})
+	}
+	sort.Slice(instruments, func(i, j int) bool { return instruments[i].FIGI < instruments[j].FIGI })
+	if len(instruments) == 1 {
+		instruments[0].Primary = true
+	}
+	return instruments
+}
+
+// primaryFIGI returns the FIGI of the primary listing, or of the first instrument if none is flagged.
+func primaryFIGI(instruments []instrument) string {
+	for _, fi := range instruments {
+		if fi.Primary {
+			return fi.FIGI
+		}
+	}
+	if len(instruments) == 0 {
+		return ""
+	}
+	return instruments[0].FIGI
+}
+
 func getPredicateFromRelationship(relationship string) (predicate string, err error) {
 	predicate = predicates[relationship]
 	if predicate == "" {
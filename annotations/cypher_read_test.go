@@ -3,11 +3,17 @@ package annotations
 import (
 	"encoding/json"
 	"errors"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/Financial-Times/go-logger/v2"
 	"github.com/Financial-Times/neo-utils-go/v2/neoutils"
 	"github.com/jmcvetta/neoism"
+	"github.com/rcrowley/go-metrics"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type MockNeoConnection struct {
@@ -113,6 +119,10 @@ func TestCypherDriverReadBrand(t *testing.T) {
 						t.Fatal("Unexpected query param")
 					}
 					q := queries[0]
+					if q.Statement != defaultDerivations[0].statement {
+						// only the explicit annotations query returns results
+						return nil
+					}
 					// we use json marshall and unmarshall so we don't have to use reflection directly
 					jsonAnn, err := json.Marshal(test.neoResult)
 					assert.NoError(err, "Unexpected error marshalling Neo results")
@@ -123,15 +133,424 @@ func TestCypherDriverReadBrand(t *testing.T) {
 			}
 
 			testDriver := NewCypherDriver(mockConn, "test")
-			result, found, err := testDriver.read("contentUUID")
+			result, err := testDriver.read("contentUUID", defaultReadOptions(testDriver))
 			if !test.expectedError && err != nil {
 				t.Fatalf("Unexpected error reading annotations: %v", err)
 			}
-			assert.Equal(found, test.expectedFound)
+			assert.Equal(result.found, test.expectedFound)
 			if test.expectedError {
 				assert.Error(err, "Expected error reading annotations")
 			}
-			assert.Equal(test.expectedResult, result)
+			assert.Equal(test.expectedResult, result.anns)
+		})
+	}
+}
+
+func TestCypherDriverReadPartialResults(t *testing.T) {
+	derivationResults := map[string]neoAnnotation{
+		"explicit":     {Predicate: "ABOUT", ID: "explicit", Types: []string{"Topic"}},
+		"brandParents": {Predicate: "IMPLICITLY_CLASSIFIED_BY", ID: "parent", Types: []string{"Brand"}},
+		"impliedBy":    {Predicate: "IMPLICITLY_CLASSIFIED_BY", ID: "implied", Types: []string{"Brand"}},
+		"broader":      {Predicate: "IMPLICITLY_ABOUT", ID: "broader", Types: []string{"Topic"}},
+	}
+	tests := map[string]struct {
+		failing         string
+		slow            string
+		expectedIDs     []string
+		expectedMissing []string
+		expectedError   bool
+	}{
+		"all derivations succeed": {
+			expectedIDs: []string{"explicit", "parent", "implied", "broader"},
+		},
+		"failing implicit derivation is reported as missing": {
+			failing:         "impliedBy",
+			expectedIDs:     []string{"explicit", "parent", "broader"},
+			expectedMissing: []string{"impliedBy"},
+		},
+		"slow implicit derivation is reported as missing": {
+			slow:            "broader",
+			expectedIDs:     []string{"explicit", "parent", "implied"},
+			expectedMissing: []string{"broader"},
+		},
+		"failing explicit derivation fails the read": {
+			failing:       "explicit",
+			expectedError: true,
+		},
+	}
+
+	var queried int
+	for _, d := range defaultDerivations {
+		if defaultReadOptions(NewCypherDriver(nil, "test")).includes(d) {
+			queried++
+		}
+	}
+
+	for name, tc := range tests {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			release := make(chan struct{})
+			finished := make(chan struct{}, queried)
+			// the derivations left running by read must finish before the next case
+			defer func() {
+				close(release)
+				for i := 0; i < queried; i++ {
+					<-finished
+				}
+			}()
+			mockConn := MockNeoConnection{
+				cypherBatch: func(queries []*neoism.CypherQuery) error {
+					defer func() { finished <- struct{}{} }()
+					for _, d := range defaultDerivations {
+						if queries[0].Statement != NewCypherDriver(nil, "test").statement(d, defaultReadOptions(NewCypherDriver(nil, "test"))) {
+							continue
+						}
+						if d.name == tc.failing {
+							return errors.New("test error")
+						}
+						if d.name == tc.slow {
+							<-release
+						}
+						jsonAnn, err := json.Marshal([]neoAnnotation{derivationResults[d.name]})
+						if err != nil {
+							return err
+						}
+						return json.Unmarshal(jsonAnn, queries[0].Result)
+					}
+					return errors.New("unexpected query")
+				},
+			}
+
+			testDriver := NewCypherDriver(mockConn, "test", WithDerivationTimeout(50*time.Millisecond),
+				WithLogger(logger.NewUPPLogger("test-public-annotations-api", "PANIC")))
+			result, err := testDriver.read("contentUUID", defaultReadOptions(testDriver))
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			var ids []string
+			for _, ann := range result.anns {
+				ids = append(ids, strings.TrimPrefix(ann.ID, "http://api.ft.com/things/"))
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+			assert.Equal(t, tc.expectedMissing, result.missingDerivations)
+		})
+	}
+}
+
+func TestCypherDriverReadDroppedRows(t *testing.T) {
+	tests := map[string]struct {
+		neoResult       []neoAnnotation
+		expectedFound   bool
+		expectedDropped []droppedAnnotation
+		expectedMeters  map[string]int64
+	}{
+		"rows that cannot be mapped are dropped": {
+			neoResult: []neoAnnotation{
+				{Predicate: "ABOUT", ID: "topic", Types: []string{"Topic"}},
+				{Predicate: "ABOUT", ID: "unknown-type", Types: []string{"UnknownType"}},
+				{Predicate: "UNKNOWN_RELATIONSHIP", ID: "brand", Types: []string{"Brand"}},
+				{Predicate: "MENTIONS", ID: "no-types"},
+			},
+			expectedFound: true,
+			expectedDropped: []droppedAnnotation{
+				{Reason: droppedUnknownType, ConceptID: "http://api.ft.com/things/unknown-type", Relationship: "ABOUT"},
+				{Reason: droppedUnknownPredicate, ConceptID: "http://api.ft.com/things/brand", Relationship: "UNKNOWN_RELATIONSHIP"},
+				{Reason: droppedUnknownType, ConceptID: "http://api.ft.com/things/no-types", Relationship: "MENTIONS"},
+			},
+			expectedMeters: map[string]int64{droppedUnknownType: 2, droppedUnknownPredicate: 1},
+		},
+		"content is not found when every row is dropped": {
+			neoResult: []neoAnnotation{
+				{Predicate: "UNKNOWN_RELATIONSHIP", ID: "brand", Types: []string{"Brand"}},
+			},
+			expectedDropped: []droppedAnnotation{
+				{Reason: droppedUnknownPredicate, ConceptID: "http://api.ft.com/things/brand", Relationship: "UNKNOWN_RELATIONSHIP"},
+			},
+			expectedMeters: map[string]int64{droppedUnknownPredicate: 1},
+		},
+		"no rows are dropped": {
+			neoResult: []neoAnnotation{
+				{Predicate: "ABOUT", ID: "topic", Types: []string{"Topic"}},
+			},
+			expectedFound: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			mockConn := MockNeoConnection{
+				cypherBatch: func(queries []*neoism.CypherQuery) error {
+					if queries[0].Statement != defaultDerivations[0].statement {
+						return nil
+					}
+					jsonAnn, err := json.Marshal(tc.neoResult)
+					if err != nil {
+						return err
+					}
+					return json.Unmarshal(jsonAnn, queries[0].Result)
+				},
+			}
+			registry := metrics.NewRegistry()
+
+			testDriver := NewCypherDriver(mockConn, "test",
+				WithLogger(logger.NewUPPLogger("test-public-annotations-api", "PANIC")), WithMetricsRegistry(registry))
+			result, err := testDriver.read("contentUUID", defaultReadOptions(testDriver))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedFound, result.found)
+			assert.Equal(t, tc.expectedDropped, result.dropped)
+			for _, reason := range []string{droppedUnknownType, droppedUnknownPredicate} {
+				var count int64
+				if meter, ok := registry.Get("annotations.mapping.dropped." + reason).(metrics.Meter); ok {
+					count = meter.Count()
+				}
+				assert.Equal(t, tc.expectedMeters[reason], count, "dropped rows with reason %s", reason)
+			}
 		})
 	}
 }
+
+func TestCypherDriverReadSelectedDerivations(t *testing.T) {
+	var mu sync.Mutex
+	var statements []string
+	mockConn := MockNeoConnection{
+		cypherBatch: func(queries []*neoism.CypherQuery) error {
+			mu.Lock()
+			defer mu.Unlock()
+			statements = append(statements, queries[0].Statement)
+			return nil
+		},
+	}
+
+	testDriver := NewCypherDriver(mockConn, "test")
+	opts := readOptions{derivations: []string{"broader"}}
+	_, err := testDriver.read("contentUUID", opts)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{testDriver.statement(defaultDerivations[0], opts), testDriver.statement(defaultDerivations[3], opts)}, statements,
+		"only the explicit annotations and the selected derivations should be queried")
+}
+
+func TestCypherDriverRelatedBoundsCandidates(t *testing.T) {
+	var query *neoism.CypherQuery
+	mockConn := MockNeoConnection{
+		cypherBatch: func(queries []*neoism.CypherQuery) error {
+			query = queries[0]
+			return nil
+		},
+	}
+
+	_, err := NewCypherDriver(mockConn, "test").related("contentUUID", []conceptWeight{{ID: "concept", Weight: 3}}, 10)
+	require.NoError(t, err)
+	assert.Equal(t, relatedCandidatesPerConcept, query.Parameters["candidates"])
+	assert.Contains(t, query.Statement, "[..{candidates}] as candidates", "the candidates of each concept should be bounded")
+}
+
+func TestCypherDriverStatementDepth(t *testing.T) {
+	brandParents := defaultDerivations[1]
+	tests := map[string]struct {
+		driver        cypherDriver
+		opts          readOptions
+		expectedDepth string
+	}{
+		"default maximum depth": {
+			driver:        NewCypherDriver(nil, "test"),
+			opts:          defaultReadOptions(NewCypherDriver(nil, "test")),
+			expectedDepth: "HAS_PARENT*0..10]",
+		},
+		"configured maximum depth": {
+			driver:        NewCypherDriver(nil, "test", WithMaxDepth("brandParents", 3)),
+			opts:          defaultReadOptions(NewCypherDriver(nil, "test")),
+			expectedDepth: "HAS_PARENT*0..3]",
+		},
+		"requested depth lower than the configured one": {
+			driver:        NewCypherDriver(nil, "test", WithMaxDepth("brandParents", 3)),
+			opts:          readOptions{maxDepths: map[string]int{"brandParents": 1}},
+			expectedDepth: "HAS_PARENT*0..1]",
+		},
+		"requested depth higher than the configured one": {
+			driver:        NewCypherDriver(nil, "test", WithMaxDepth("brandParents", 3)),
+			opts:          readOptions{maxDepths: map[string]int{"brandParents": 50}},
+			expectedDepth: "HAS_PARENT*0..3]",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Contains(t, tc.driver.statement(brandParents, tc.opts), tc.expectedDepth)
+		})
+	}
+
+	assert.Contains(t, NewCypherDriver(nil, "test", WithMaxDepth("brandParents", 0)).statement(brandParents, defaultReadOptions(NewCypherDriver(nil, "test"))),
+		"HAS_PARENT*0..10]", "a configured depth of 0 should keep the maximum depth of the rule")
+	assert.Contains(t, NewCypherDriver(nil, "test").statement(defaultDerivations[3], readOptions{maxDepths: map[string]int{"broader": 0}}),
+		"HAS_BROADER*1..1]", "depth should not go below the minimum of the traversal")
+}
+
+func TestCypherDriverMissingIndexes(t *testing.T) {
+	mockConn := MockNeoConnection{
+		cypherBatch: func(queries []*neoism.CypherQuery) error {
+			indexes := []map[string]string{
+				{"description": "INDEX ON :Content(uuid)", "state": "ONLINE"},
+				{"description": "INDEX ON :Concept(prefUUID)", "state": "POPULATING"},
+				{"description": "INDEX ON :Thing(uuid)", "state": "ONLINE"},
+			}
+			jsonIndexes, err := json.Marshal(indexes)
+			if err != nil {
+				return err
+			}
+			return json.Unmarshal(jsonIndexes, queries[0].Result)
+		},
+	}
+
+	missing, err := NewCypherDriver(mockConn, "test").missingIndexes()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"INDEX ON :Concept(prefUUID)"}, missing, "indexes that are not online should be reported")
+}
+
+func TestMapInstruments(t *testing.T) {
+	tests := map[string]struct {
+		instruments  []neoInstrument
+		expected     []instrument
+		expectedFIGI string
+	}{
+		"organisation without instruments": {},
+		"single instrument is the primary listing": {
+			instruments:  []neoInstrument{{FIGI: "BBG000BBZTH2"}},
+			expected:     []instrument{{FIGI: "BBG000BBZTH2", Primary: true}},
+			expectedFIGI: "BBG000BBZTH2",
+		},
+		"flagged primary listing": {
+			instruments: []neoInstrument{
+				{FIGI: "BBG000BBZTH2", Ticker: "DBK", Exchange: "XETR"},
+				{FIGI: "BBG000BBZTH1", Ticker: "DB", Exchange: "XNYS"},
+				{FIGI: "BBG000BBZTH3", Ticker: "DBK", Exchange: "XFRA", Primary: true},
+			},
+			expected: []instrument{
+				{FIGI: "BBG000BBZTH1", Ticker: "DB", Exchange: "XNYS"},
+				{FIGI: "BBG000BBZTH2", Ticker: "DBK", Exchange: "XETR"},
+				{FIGI: "BBG000BBZTH3", Ticker: "DBK", Exchange: "XFRA", Primary: true},
+			},
+			expectedFIGI: "BBG000BBZTH3",
+		},
+		"no flagged primary listing": {
+			instruments:  []neoInstrument{{FIGI: "BBG000BBZTH2"}, {FIGI: "BBG000BBZTH1"}, {FIGI: "BBG000BBZTH2"}, {}},
+			expected:     []instrument{{FIGI: "BBG000BBZTH1"}, {FIGI: "BBG000BBZTH2"}},
+			expectedFIGI: "BBG000BBZTH1",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ann, err := mapToResponseFormat(neoAnnotation{
+				ID:          "eac853f5-3859-4c08-8540-55e043719400",
+				Types:       []string{"Thing", "Concept", "Organisation"},
+				Predicate:   "MENTIONS",
+				Instruments: tc.instruments,
+			}, "prod")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, ann.Instruments)
+			assert.Equal(t, tc.expectedFIGI, ann.FIGI)
+		})
+	}
+}
+
+func TestCypherDriverStatementConceptDetails(t *testing.T) {
+	driver := NewCypherDriver(nil, "test")
+	opts := defaultReadOptions(driver)
+	opts.conceptDetails = true
+
+	for _, d := range defaultDerivations {
+		t.Run(d.name, func(t *testing.T) {
+			withDetails := driver.statement(d, opts)
+			assert.Contains(t, withDetails, d.concept+".aliases as aliases")
+			assert.Contains(t, withDetails, d.concept+".scopeNote as scopeNote")
+			assert.NotContains(t, withDetails, "%!", "the statement should be formatted correctly")
+
+			assert.NotContains(t, driver.statement(d, defaultReadOptions(driver)), ".aliases as aliases")
+		})
+	}
+
+	assert.NotEqual(t, defaultReadOptions(driver).key(), opts.key(), "reads with and without concept details should not be coalesced")
+}
+
+func TestCypherDriverStatementProvenance(t *testing.T) {
+	driver := NewCypherDriver(nil, "test")
+	opts := defaultReadOptions(driver)
+	opts.provenance = true
+
+	for _, d := range defaultDerivations {
+		t.Run(d.name, func(t *testing.T) {
+			withProvenance := driver.statement(d, opts)
+			if d.implicit {
+				assert.NotContains(t, withProvenance, "annotatedBy", "implicit annotations have no provenance")
+				return
+			}
+			assert.Contains(t, withProvenance, "rel.annotatedBy as annotatedBy")
+			assert.Contains(t, withProvenance, "rel.confidenceScore as confidenceScore")
+			assert.NotContains(t, driver.statement(d, defaultReadOptions(driver)), "annotatedBy")
+		})
+	}
+
+	assert.NotEqual(t, defaultReadOptions(driver).key(), opts.key(), "reads with and without provenance should not be coalesced")
+}
+
+func TestMapProvenance(t *testing.T) {
+	ann, err := mapToResponseFormat(neoAnnotation{
+		ID:              "eac853f5-3859-4c08-8540-55e043719400",
+		Types:           []string{"Thing", "Concept", "Organisation"},
+		Predicate:       "MENTIONS",
+		Lifecycle:       pacLifecycle,
+		AnnotatedBy:     "0edd3c31-1fd0-4ef6-9230-8d545be3880a",
+		AnnotatedDate:   "2016-01-20T19:43:47.314Z",
+		RelevanceScore:  0.8,
+		ConfidenceScore: 0.99,
+	}, "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, provenance{
+		AnnotatedBy:     "http://api.ft.com/things/0edd3c31-1fd0-4ef6-9230-8d545be3880a",
+		AnnotatedDate:   "2016-01-20T19:43:47.314Z",
+		RelevanceScore:  0.8,
+		ConfidenceScore: 0.99,
+	}, ann.Provenance)
+}
+
+func TestWithDerivationRules(t *testing.T) {
+	derivations, err := compileDerivations([]DerivationRule{{
+		Name:             "orgParents",
+		SourcePredicates: []string{"ABOUT"},
+		Relationship:     "SUB_ORGANISATION_OF",
+		Direction:        outgoing,
+		MinDepth:         1,
+		MaxDepth:         3,
+		Predicate:        "IMPLICITLY_ABOUT",
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"brandParents", "impliedBy", "broader", "organisationParents", "locationParents"}, NewCypherDriver(nil, "test").implicitDerivations(),
+		"the default rules should be run without derivation rules")
+	driver := NewCypherDriver(nil, "test", WithDerivationRules(derivations))
+	assert.Equal(t, []string{"orgParents"}, driver.implicitDerivations())
+	assert.Equal(t, []string{"orgParents"}, defaultReadOptions(driver).derivations)
+}
+
+func TestCheckMaxDepth(t *testing.T) {
+	driver := NewCypherDriver(nil, "test")
+	assert.NoError(t, driver.CheckMaxDepth("brandParents"))
+	assert.Error(t, driver.CheckMaxDepth("explicit"), "the explicit annotations do not traverse a hierarchy")
+
+	derivations, err := compileDerivations([]DerivationRule{{
+		Name:             "orgParents",
+		SourcePredicates: []string{"ABOUT"},
+		Relationship:     "SUB_ORGANISATION_OF",
+		Direction:        outgoing,
+		MinDepth:         1,
+		MaxDepth:         3,
+		Predicate:        "IMPLICITLY_ABOUT",
+	}})
+	require.NoError(t, err)
+	driver = NewCypherDriver(nil, "test", WithDerivationRules(derivations))
+	assert.NoError(t, driver.CheckMaxDepth("orgParents"))
+	assert.Error(t, driver.CheckMaxDepth("brandParents"), "the depth of a derivation not in the rules of the driver cannot be limited")
+}
@@ -66,6 +66,7 @@ const (
 	topicType        = "http://www.ft.com/ontology/Topic"
 	genreType        = "http://www.ft.com/ontology/Genre"
 	organisationType = "http://www.ft.com/ontology/organisation/Organisation"
+	locationType     = "http://www.ft.com/ontology/Location"
 )
 
 var (
@@ -109,6 +110,11 @@ var (
 			"http://www.ft.com/ontology/concept/Concept",
 			organisationType,
 		},
+		locationType: {
+			"http://www.ft.com/ontology/core/Thing",
+			"http://www.ft.com/ontology/concept/Concept",
+			locationType,
+		},
 	}
 
 	conceptApiUrlTemplates = map[string]string{
@@ -116,6 +122,7 @@ var (
 		topicType:        "http://api.ft.com/things/%s",
 		genreType:        "http://api.ft.com/things/%s",
 		organisationType: "http://api.ft.com/organisations/%s",
+		locationType:     "http://api.ft.com/things/%s",
 	}
 )
 
@@ -175,8 +182,8 @@ func (s *cypherDriverTestSuite) TestRetrieveMultipleAnnotations() {
 		getExpectedMetalMickeyAnnotation(v1Lifecycle),
 		getExpectedAlphavilleSeriesAnnotation(v1Lifecycle),
 		expectedAnnotation(brandGrandChildUUID, brandType, predicates["IS_CLASSIFIED_BY"], v1Lifecycle),
-		expectedAnnotation(brandChildUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle),
-		expectedAnnotation(brandParentUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle),
+		withDepth(expectedAnnotation(brandChildUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle), 1),
+		withDepth(expectedAnnotation(brandParentUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle), 2),
 	}
 
 	driver := NewCypherDriver(s.db, "prod")
@@ -215,8 +222,8 @@ func (s *cypherDriverTestSuite) TestRetrievePacAndV2AnnotationsAsPriority() {
 func (s *cypherDriverTestSuite) TestRetrieveImplicitAbouts() {
 	expectedAnnotations := annotations{
 		expectedAnnotation(aboutTopic, topicType, predicates["ABOUT"], pacLifecycle),
-		expectedAnnotation(broaderTopicA, topicType, predicates["IMPLICITLY_ABOUT"], pacLifecycle),
-		expectedAnnotation(broaderTopicB, topicType, predicates["IMPLICITLY_ABOUT"], pacLifecycle),
+		withDepth(expectedAnnotation(broaderTopicA, topicType, predicates["IMPLICITLY_ABOUT"], pacLifecycle), 1),
+		withDepth(expectedAnnotation(broaderTopicB, topicType, predicates["IMPLICITLY_ABOUT"], pacLifecycle), 2),
 		getExpectedMallStreetJournalAnnotation(v2Lifecycle),
 		getExpectedMentionsFakebookAnnotation(v2Lifecycle),
 	}
@@ -230,14 +237,60 @@ func (s *cypherDriverTestSuite) TestRetrieveImplicitAbouts() {
 	assertListContainsAll(s.T(), anns, expectedAnnotations)
 }
 
+func (s *cypherDriverTestSuite) TestRetrieveConceptDetails() {
+	writeAboutAnnotations(s.T(), s.db)
+	driver := NewCypherDriver(s.db, "prod")
+	opts := defaultReadOptions(driver)
+	opts.conceptDetails = true
+
+	result, err := driver.read(contentUUID, opts)
+	assert.NoError(s.T(), err)
+
+	expectedAliases := map[string][]string{
+		fmt.Sprintf("http://api.ft.com/things/%s", aboutTopic):    {"Ashes 2017"},
+		fmt.Sprintf("http://api.ft.com/things/%s", broaderTopicA): {"The Ashes"},
+	}
+	for _, ann := range applyDefaultFilters(result.anns) {
+		if aliases, ok := expectedAliases[ann.ID]; ok {
+			assert.Equal(s.T(), aliases, ann.Aliases, "Didn't get the expected aliases of %s", ann.ID)
+			delete(expectedAliases, ann.ID)
+		}
+	}
+	assert.Empty(s.T(), expectedAliases, "Didn't get all the expected annotations")
+}
+
+func (s *cypherDriverTestSuite) TestRetrieveRelatedContent() {
+	service := annrw.NewCypherAnnotationsService(s.db)
+	assert.NoError(s.T(), service.Initialise())
+	writeJSONToAnnotationsService(s.T(), service, "pac", "annotations-pac", contentWithNoAnnotationsUUID, "./testdata/related/about-fakebook.json")
+	writeJSONToAnnotationsService(s.T(), service, "pac", "annotations-pac", contentWithOnlyFTUUID, "./testdata/related/mentions-msj.json")
+
+	driver := NewCypherDriver(s.db, "prod")
+	concepts := []conceptWeight{{ID: FakebookConceptUUID, Weight: 1}, {ID: MSJConceptUUID, Weight: 1}}
+	related, err := driver.related(contentUUID, concepts, 10)
+	require.NoError(s.T(), err)
+
+	require.Len(s.T(), related, 2, "Didn't get the same number of related content")
+	assert.Equal(s.T(), fmt.Sprintf("http://api.ft.com/things/%s", contentWithNoAnnotationsUUID), related[0].ID)
+	assert.Equal(s.T(), 3.0, related[0].Score, "content about a shared concept should weigh the most")
+	require.Len(s.T(), related[0].SharedConcepts, 1)
+	assert.Equal(s.T(), fmt.Sprintf("http://api.ft.com/things/%s", FakebookConceptUUID), related[0].SharedConcepts[0].ID)
+	assert.Equal(s.T(), fmt.Sprintf("http://api.ft.com/things/%s", contentWithOnlyFTUUID), related[1].ID)
+	assert.Equal(s.T(), 1.0, related[1].Score)
+
+	related, err = driver.related(contentUUID, concepts, 1)
+	require.NoError(s.T(), err)
+	assert.Len(s.T(), related, 1, "the related content should be limited")
+}
+
 func (s *cypherDriverTestSuite) TestRetrieveCyclicImplicitAbouts() {
 	expectedAnnotations := annotations{
 		expectedAnnotation(narrowerTopic, topicType, predicates["ABOUT"], pacLifecycle),
-		expectedAnnotation(aboutTopic, topicType, predicates["IMPLICITLY_ABOUT"], pacLifecycle),
-		expectedAnnotation(broaderTopicA, topicType, predicates["IMPLICITLY_ABOUT"], pacLifecycle),
-		expectedAnnotation(broaderTopicB, topicType, predicates["IMPLICITLY_ABOUT"], pacLifecycle),
-		expectedAnnotation(cyclicTopicA, topicType, predicates["IMPLICITLY_ABOUT"], pacLifecycle),
-		expectedAnnotation(cyclicTopicB, topicType, predicates["IMPLICITLY_ABOUT"], pacLifecycle),
+		withDepth(expectedAnnotation(aboutTopic, topicType, predicates["IMPLICITLY_ABOUT"], pacLifecycle), 1),
+		withDepth(expectedAnnotation(broaderTopicA, topicType, predicates["IMPLICITLY_ABOUT"], pacLifecycle), 2),
+		withDepth(expectedAnnotation(broaderTopicB, topicType, predicates["IMPLICITLY_ABOUT"], pacLifecycle), 3),
+		withDepth(expectedAnnotation(cyclicTopicA, topicType, predicates["IMPLICITLY_ABOUT"], pacLifecycle), 2),
+		withDepth(expectedAnnotation(cyclicTopicB, topicType, predicates["IMPLICITLY_ABOUT"], pacLifecycle), 1),
 		getExpectedMentionsFakebookAnnotation(v2Lifecycle),
 		getExpectedMallStreetJournalAnnotation(v2Lifecycle),
 	}
@@ -260,8 +313,8 @@ func (s *cypherDriverTestSuite) TestRetrieveMultipleAnnotationsIfPacAnnotationCa
 		getExpectedMetalMickeyAnnotation(v1Lifecycle),
 		getExpectedAlphavilleSeriesAnnotation(v1Lifecycle),
 		expectedAnnotation(brandGrandChildUUID, brandType, predicates["IS_CLASSIFIED_BY"], v1Lifecycle),
-		expectedAnnotation(brandChildUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle),
-		expectedAnnotation(brandParentUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle),
+		withDepth(expectedAnnotation(brandChildUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle), 1),
+		withDepth(expectedAnnotation(brandParentUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle), 2),
 	}
 
 	driver := NewCypherDriver(s.db, "prod")
@@ -281,8 +334,8 @@ func (s *cypherDriverTestSuite) TestRetrieveMultipleAnnotationsIfPacAnnotationCa
 func (s *cypherDriverTestSuite) TestRetrieveContentWithParentBrand() {
 	expectedAnnotations := annotations{
 		expectedAnnotation(brandGrandChildUUID, brandType, predicates["IS_CLASSIFIED_BY"], v1Lifecycle),
-		expectedAnnotation(brandChildUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle),
-		expectedAnnotation(brandParentUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle),
+		withDepth(expectedAnnotation(brandChildUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle), 1),
+		withDepth(expectedAnnotation(brandParentUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle), 2),
 	}
 
 	driver := NewCypherDriver(s.db, "prod")
@@ -294,8 +347,8 @@ func (s *cypherDriverTestSuite) TestRetrieveContentWithParentBrand() {
 func (s *cypherDriverTestSuite) TestRetrieveContentWithGrandParentBrand() {
 	expectedAnnotations := annotations{
 		expectedAnnotation(brandGrandChildUUID, brandType, predicates["IS_CLASSIFIED_BY"], v1Lifecycle),
-		expectedAnnotation(brandChildUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle),
-		expectedAnnotation(brandParentUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle),
+		withDepth(expectedAnnotation(brandChildUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle), 1),
+		withDepth(expectedAnnotation(brandParentUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle), 2),
 	}
 
 	driver := NewCypherDriver(s.db, "prod")
@@ -307,7 +360,7 @@ func (s *cypherDriverTestSuite) TestRetrieveContentWithGrandParentBrand() {
 func (s *cypherDriverTestSuite) TestRetrieveContentWithCircularBrand() {
 	expectedAnnotations := annotations{
 		expectedAnnotation(brandCircularAUUID, brandType, predicates["IS_CLASSIFIED_BY"], v1Lifecycle),
-		expectedAnnotation(brandCircularBUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle),
+		withDepth(expectedAnnotation(brandCircularBUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle), 1),
 	}
 
 	driver := NewCypherDriver(s.db, "prod")
@@ -332,7 +385,7 @@ func (s *cypherDriverTestSuite) TestRetrieveContentWithJustParentBrand() {
 func (s *cypherDriverTestSuite) TestRetrieveContentBrandsOfDifferentTypes() {
 	expectedAnnotations := annotations{
 		expectedAnnotation(brandCircularAUUID, brandType, predicates["IS_CLASSIFIED_BY"], v1Lifecycle),
-		expectedAnnotation(brandCircularBUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle),
+		withDepth(expectedAnnotation(brandCircularBUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], v1Lifecycle), 1),
 	}
 
 	driver := NewCypherDriver(s.db, "prod")
@@ -348,7 +401,7 @@ func (s *cypherDriverTestSuite) TestRetrieveAnnotationWithHasBrand() {
 		expectedAnnotation(brandHubPageUUID, brandType, predicates["IS_CLASSIFIED_BY"], pacLifecycle),
 		expectedAnnotation(brandWithHasBrandPredicateUUID, brandType, predicates["IS_CLASSIFIED_BY"], pacLifecycle),
 		expectedAnnotation(genreOpinionUUID, genreType, predicates["IS_CLASSIFIED_BY"], pacLifecycle),
-		expectedAnnotation(brandParentUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], pacLifecycle),
+		withDepth(expectedAnnotation(brandParentUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], pacLifecycle), 1),
 	}
 
 	driver := NewCypherDriver(s.db, "prod")
@@ -393,17 +446,18 @@ func (s *cypherDriverTestSuite) TestTransitivePropertyOfImpliedBy() {
 		Fixture   string // concept fixture
 		Type      string // expected concept type
 		Predicate string // expected annotations predicate
+		Depth     int    // expected depth of implicit annotations
 	}{
 		{Fixture: "./testdata/testImplicitlyClassifiedBy/topic2-about.json", Type: topicType, Predicate: "ABOUT"},
 		{Fixture: "./testdata/testImplicitlyClassifiedBy/topic1-mentions.json", Type: topicType, Predicate: "MENTIONS"},
 		{Fixture: "./testdata/testImplicitlyClassifiedBy/organisation1-about.json", Type: organisationType, Predicate: "ABOUT"},
 		{Fixture: "./testdata/testImplicitlyClassifiedBy/brand1-isClassifiedBy.json", Type: brandType, Predicate: "IS_CLASSIFIED_BY"},
-		{Fixture: "./testdata/testImplicitlyClassifiedBy/topic3-broader-topic2.json", Type: topicType, Predicate: "IMPLICITLY_ABOUT"},
+		{Fixture: "./testdata/testImplicitlyClassifiedBy/topic3-broader-topic2.json", Type: topicType, Predicate: "IMPLICITLY_ABOUT", Depth: 1},
 		{Fixture: "./testdata/testImplicitlyClassifiedBy/topic4-impliedBy-organisation1.json", Type: topicType},
 		{Fixture: "./testdata/testImplicitlyClassifiedBy/brand6-impliedBy-organisation2.json", Type: organisationType},
-		{Fixture: "./testdata/testImplicitlyClassifiedBy/brand2-impliedBy-topic2.json", Type: brandType, Predicate: "IMPLICITLY_CLASSIFIED_BY"},
-		{Fixture: "./testdata/testImplicitlyClassifiedBy/brand5-parent-brand1.json", Type: brandType, Predicate: "IMPLICITLY_CLASSIFIED_BY"},
-		{Fixture: "./testdata/testImplicitlyClassifiedBy/topic5-broader-topic3.json", Type: topicType, Predicate: "IMPLICITLY_ABOUT"},
+		{Fixture: "./testdata/testImplicitlyClassifiedBy/brand2-impliedBy-topic2.json", Type: brandType, Predicate: "IMPLICITLY_CLASSIFIED_BY", Depth: 1},
+		{Fixture: "./testdata/testImplicitlyClassifiedBy/brand5-parent-brand1.json", Type: brandType, Predicate: "IMPLICITLY_CLASSIFIED_BY", Depth: 1},
+		{Fixture: "./testdata/testImplicitlyClassifiedBy/topic5-broader-topic3.json", Type: topicType, Predicate: "IMPLICITLY_ABOUT", Depth: 2},
 		{Fixture: "./testdata/testImplicitlyClassifiedBy/brand4-parent-brand2.json", Type: brandType},
 		{Fixture: "./testdata/testImplicitlyClassifiedBy/brand3-impliedBy-topic3.json", Type: brandType},
 	}
@@ -414,7 +468,7 @@ func (s *cypherDriverTestSuite) TestTransitivePropertyOfImpliedBy() {
 		if c.Predicate == "" {
 			continue
 		}
-		expected = append(expected, expectedAnnotationWithPrefLabel(UUID, c.Type, predicates[c.Predicate], pacLifecycle, prefLabel))
+		expected = append(expected, withDepth(expectedAnnotationWithPrefLabel(UUID, c.Type, predicates[c.Predicate], pacLifecycle, prefLabel), c.Depth))
 	}
 
 	writeJSONToAnnotationsService(t, annotationRW, "pac", "annotations-pac", contentID, "./testdata/testImplicitlyClassifiedBy/annotations.json")
@@ -479,7 +533,7 @@ func (s *cypherDriverTestSuite) TestRetrieveAnnotationsWithImpliedBy() {
 			Annotations: "./testdata/impliedBy/annotation-topic-about.json",
 			ExpectedAnnotations: annotations{
 				expectedAnnotationWithPrefLabel(topicUUID, topicType, predicates["ABOUT"], pacLifecycle, topicLabel),
-				expectedAnnotationWithPrefLabel(brandUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], pacLifecycle, brandLabel),
+				withDepth(expectedAnnotationWithPrefLabel(brandUUID, brandType, predicates["IMPLICITLY_CLASSIFIED_BY"], pacLifecycle, brandLabel), 1),
 			},
 		},
 		"direct isClassifiedBy annotations should override implicit ones": {
@@ -518,6 +572,117 @@ func (s *cypherDriverTestSuite) TestRetrieveAnnotationsWithImpliedBy() {
 	deleteUUIDs(t, db, cleanUUIDs)
 }
 
+func (s *cypherDriverTestSuite) TestRetrieveImplicitAboutsThroughOrganisationHierarchy() {
+	t := s.T()
+	db := s.db
+
+	contentRW := content.NewCypherContentService(db)
+	assert.NoError(t, contentRW.Initialise())
+
+	conceptRW := concepts.NewConceptService(db)
+	assert.NoError(t, conceptRW.Initialise())
+
+	annotationRW := annrw.NewCypherAnnotationsService(db)
+	assert.NoError(t, annotationRW.Initialise())
+
+	writeJSONToBaseService(contentRW, "./testdata/organisationHierarchy/content.json", t)
+	contentID, _ := readJSONFile(t, "./testdata/organisationHierarchy/content.json")["uuid"].(string)
+	removeUUIDs := []string{contentID}
+
+	organisations := []struct {
+		Fixture   string // concept fixture
+		Predicate string // expected annotations predicate
+		Depth     int    // expected depth of implicit annotations
+	}{
+		{Fixture: "./testdata/organisationHierarchy/subsidiary-about.json", Predicate: "ABOUT"},
+		{Fixture: "./testdata/organisationHierarchy/parent-sub-organisation-of-subsidiary.json", Predicate: "IMPLICITLY_ABOUT", Depth: 1},
+		{Fixture: "./testdata/organisationHierarchy/ultimate-parent-sub-organisation-of-parent.json", Predicate: "IMPLICITLY_ABOUT", Depth: 2},
+	}
+	var expected []annotation
+	for _, o := range organisations {
+		writeJSONToService(conceptRW, o.Fixture, t)
+		data := readJSONFile(t, o.Fixture)
+		uuid, _ := data["prefUUID"].(string)
+		label, _ := data["prefLabel"].(string)
+		removeUUIDs = append(removeUUIDs, uuid)
+		expected = append(expected, withDepth(expectedAnnotationWithPrefLabel(uuid, organisationType, predicates[o.Predicate], pacLifecycle, label), o.Depth))
+	}
+
+	writeJSONToAnnotationsService(t, annotationRW, "pac", "annotations-pac", contentID, "./testdata/organisationHierarchy/annotations.json")
+
+	driver := NewCypherDriver(db, "prod")
+	anns := getAndCheckAnnotations(driver, contentID, t)
+	assert.Equal(t, len(expected), len(anns), "Didn't get the same number of annotations")
+	assertListContainsAll(t, anns, expected)
+	deleteUUIDs(t, db, removeUUIDs)
+}
+
+func (s *cypherDriverTestSuite) TestRetrieveImplicitAboutsThroughLocationHierarchy() {
+	t := s.T()
+	db := s.db
+
+	contentRW := content.NewCypherContentService(db)
+	assert.NoError(t, contentRW.Initialise())
+
+	conceptRW := concepts.NewConceptService(db)
+	assert.NoError(t, conceptRW.Initialise())
+
+	annotationRW := annrw.NewCypherAnnotationsService(db)
+	assert.NoError(t, annotationRW.Initialise())
+
+	writeJSONToBaseService(contentRW, "./testdata/locationHierarchy/content.json", t)
+	contentID, _ := readJSONFile(t, "./testdata/locationHierarchy/content.json")["uuid"].(string)
+	removeUUIDs := []string{contentID}
+
+	// the concepts rw writes the containment of a location as its broader locations
+	writeLocation := func(fixture string) (string, string) {
+		writeJSONToService(conceptRW, fixture, t)
+		data := readJSONFile(t, fixture)
+		uuid, _ := data["prefUUID"].(string)
+		label, _ := data["prefLabel"].(string)
+		removeUUIDs = append(removeUUIDs, uuid)
+		return uuid, label
+	}
+	cityUUID, cityLabel := writeLocation("./testdata/locationHierarchy/city-has-broader-region.json")
+	regionUUID, regionLabel := writeLocation("./testdata/locationHierarchy/region-has-broader-country.json")
+	countryUUID, countryLabel := writeLocation("./testdata/locationHierarchy/country.json")
+
+	tests := map[string]struct {
+		Annotations         string
+		ExpectedAnnotations annotations
+	}{
+		"every location containing the city is implicitly about": {
+			Annotations: "./testdata/locationHierarchy/annotations-city-about.json",
+			ExpectedAnnotations: annotations{
+				expectedAnnotationWithPrefLabel(cityUUID, locationType, predicates["ABOUT"], pacLifecycle, cityLabel),
+				withDepth(expectedAnnotationWithPrefLabel(regionUUID, locationType, predicates["IMPLICITLY_ABOUT"], pacLifecycle, regionLabel), 1),
+				withDepth(expectedAnnotationWithPrefLabel(countryUUID, locationType, predicates["IMPLICITLY_ABOUT"], pacLifecycle, countryLabel), 2),
+			},
+		},
+		"explicit abouts are not implicitly about": {
+			Annotations: "./testdata/locationHierarchy/annotations-city-and-country-about.json",
+			ExpectedAnnotations: annotations{
+				expectedAnnotationWithPrefLabel(cityUUID, locationType, predicates["ABOUT"], pacLifecycle, cityLabel),
+				withDepth(expectedAnnotationWithPrefLabel(regionUUID, locationType, predicates["IMPLICITLY_ABOUT"], pacLifecycle, regionLabel), 1),
+				expectedAnnotationWithPrefLabel(countryUUID, locationType, predicates["ABOUT"], pacLifecycle, countryLabel),
+			},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			writeJSONToAnnotationsService(t, annotationRW, "pac", "annotations-pac", contentID, test.Annotations)
+
+			driver := NewCypherDriver(db, "prod")
+			result, err := driver.read(contentID, defaultReadOptions(driver))
+			assert.NoError(t, err, "Unexpected error for content %s", contentID)
+			anns := applyDefaultFilters(result.anns)
+			assert.Equal(t, len(test.ExpectedAnnotations), len(anns), "Didn't get the same number of annotations")
+			assertListContainsAll(t, anns, test.ExpectedAnnotations)
+		})
+	}
+	deleteUUIDs(t, db, removeUUIDs)
+}
+
 func TestRetrieveNoAnnotationsWhenThereAreNonePresentExceptBrands(t *testing.T) {
 	assert := assert.New(t)
 	db := getDatabaseConnection(t)
@@ -528,10 +693,10 @@ func TestRetrieveNoAnnotationsWhenThereAreNonePresentExceptBrands(t *testing.T)
 	defer cleanDB(t, db)
 
 	driver := NewCypherDriver(db, "prod")
-	anns, found, err := driver.read(contentWithNoAnnotationsUUID)
-	anns = applyDefaultFilters(anns)
+	result, err := driver.read(contentWithNoAnnotationsUUID, defaultReadOptions(driver))
+	anns := applyDefaultFilters(result.anns)
 	assert.NoError(err, "Unexpected error for content %s", contentWithNoAnnotationsUUID)
-	assert.False(found, "Found annotations for content %s", contentWithNoAnnotationsUUID)
+	assert.False(result.found, "Found annotations for content %s", contentWithNoAnnotationsUUID)
 	assert.Equal(0, len(anns), "Didn't get the same number of annotations") // Two brands, child and parent
 }
 
@@ -577,18 +742,18 @@ func TestRetrieveNoAnnotationsWhenThereAreNoConceptsPresent(t *testing.T) {
 	defer cleanDB(t, db)
 
 	driver := NewCypherDriver(db, "prod")
-	anns, found, err := driver.read(contentUUID)
-	anns = applyDefaultFilters(anns)
+	result, err := driver.read(contentUUID, defaultReadOptions(driver))
+	anns := applyDefaultFilters(result.anns)
 	assert.NoError(err, "Unexpected error for content %s", contentUUID)
-	assert.False(found, "Found annotations for content %s", contentUUID)
+	assert.False(result.found, "Found annotations for content %s", contentUUID)
 	assert.Equal(0, len(anns), "Didn't get the same number of annotations, anns=%s", anns)
 }
 
 func getAndCheckAnnotations(driver cypherDriver, contentUUID string, t *testing.T) annotations {
-	anns, found, err := driver.read(contentUUID)
-	anns = applyDefaultFilters(anns)
+	result, err := driver.read(contentUUID, defaultReadOptions(driver))
+	anns := applyDefaultFilters(result.anns)
 	assert.NoError(t, err, "Unexpected error for content %s", contentUUID)
-	assert.True(t, found, "Found no annotations for content %s", contentUUID)
+	assert.True(t, result.found, "Found no annotations for content %s", contentUUID)
 	return anns
 }
 
@@ -844,10 +1009,11 @@ func getExpectedMentionsFakebookAnnotation(lifecycle string) annotation {
 			"http://www.ft.com/ontology/company/Company",
 			"http://www.ft.com/ontology/company/PublicCompany",
 		},
-		LeiCode:   "BQ4BKCS1HXDV9TTTTTTTT",
-		FIGI:      "BB8000C3P0-R2D2",
-		PrefLabel: "Fakebook, Inc.",
-		Lifecycle: lifecycle,
+		LeiCode:     "BQ4BKCS1HXDV9TTTTTTTT",
+		FIGI:        "BB8000C3P0-R2D2",
+		Instruments: []instrument{{FIGI: "BB8000C3P0-R2D2", Primary: true}},
+		PrefLabel:   "Fakebook, Inc.",
+		Lifecycle:   lifecycle,
 	}
 }
 
@@ -863,10 +1029,11 @@ func getExpectedAboutFakebookAnnotation(lifecycle string) annotation {
 			"http://www.ft.com/ontology/company/Company",
 			"http://www.ft.com/ontology/company/PublicCompany",
 		},
-		LeiCode:   "BQ4BKCS1HXDV9TTTTTTTT",
-		FIGI:      "BB8000C3P0-R2D2",
-		PrefLabel: "Fakebook, Inc.",
-		Lifecycle: lifecycle,
+		LeiCode:     "BQ4BKCS1HXDV9TTTTTTTT",
+		FIGI:        "BB8000C3P0-R2D2",
+		Instruments: []instrument{{FIGI: "BB8000C3P0-R2D2", Primary: true}},
+		PrefLabel:   "Fakebook, Inc.",
+		Lifecycle:   lifecycle,
 	}
 }
 
@@ -917,6 +1084,7 @@ func getExpectedHasDisplayTagFakebookAnnotation(lifecycle string) annotation {
 		Lifecycle:    lifecycle,
 		LeiCode:      "BQ4BKCS1HXDV9TTTTTTTT",
 		FIGI:         "BB8000C3P0-R2D2",
+		Instruments:  []instrument{{FIGI: "BB8000C3P0-R2D2", Primary: true}},
 		IsDeprecated: false,
 	}
 }
@@ -975,6 +1143,11 @@ func expectedAnnotationWithPrefLabel(conceptUuid string, conceptType string, pre
 	}
 }
 
+func withDepth(ann annotation, depth int) annotation {
+	ann.Depth = depth
+	return ann
+}
+
 func count(annotationLifecycle string, db neoutils.NeoConnection) (int, error) {
 	var results []struct {
 		Count int `json:"c"`
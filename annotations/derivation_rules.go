@@ -0,0 +1,244 @@
+package annotations
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+const (
+	outgoing = "outgoing"
+	incoming = "incoming"
+)
+
+var (
+	ruleNameRegex     = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9]*$`)
+	relationshipRegex = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+	labelRegex        = regexp.MustCompile(`^[A-Z][a-zA-Z0-9]*$`)
+)
+
+// DerivationRule declares an implicit annotations derivation: starting from the concepts the content is annotated with
+// by one of the source predicates, the relationship is followed in the given direction up to the maximum depth
+// and every concept reached is returned as an annotation with the resulting predicate.
+type DerivationRule struct {
+	Name string `json:"name"`
+	// SourcePredicates are the relationships between the content and the concepts the traversal starts from, all of them if empty
+	SourcePredicates []string `json:"sourcePredicates"`
+	// SourceType is the type of the concepts the traversal starts from, Concept if empty
+	SourceType string `json:"sourceType"`
+	// ExcludeSourceTypes are the types of the concepts the traversal does not start from, e.g. those left to a more specific rule
+	ExcludeSourceTypes []string `json:"excludeSourceTypes"`
+	Relationship       string   `json:"relationship"`
+	// Direction is either outgoing, from the source concept to the implicit one, or incoming
+	Direction string `json:"direction"`
+	// TargetType is the type of the concepts reached by the traversal, Concept if empty
+	TargetType string `json:"targetType"`
+	MinDepth   int    `json:"minDepth"`
+	MaxDepth   int    `json:"maxDepth"`
+	// Predicate of the derived annotations
+	Predicate string `json:"predicate"`
+	// ExcludeExplicit drops the concepts the content is already annotated with by one of the source predicates
+	ExcludeExplicit bool `json:"excludeExplicit"`
+}
+
+// defaultDerivationRules are the implicit annotations derivations used unless a rules configuration is given.
+var defaultDerivationRules = []DerivationRule{
+	{
+		Name:         "brandParents",
+		SourceType:   "Brand",
+		Relationship: "HAS_PARENT",
+		Direction:    outgoing,
+		TargetType:   "Brand",
+		MinDepth:     0,
+		MaxDepth:     defaultMaxDepth,
+		Predicate:    "IMPLICITLY_CLASSIFIED_BY",
+	},
+	{
+		Name:             "impliedBy",
+		SourcePredicates: []string{"ABOUT"},
+		SourceType:       "Topic",
+		Relationship:     "IMPLIED_BY",
+		Direction:        incoming,
+		TargetType:       "Brand",
+		MinDepth:         1,
+		MaxDepth:         defaultMaxDepth,
+		Predicate:        "IMPLICITLY_CLASSIFIED_BY",
+	},
+	{
+		Name:             "broader",
+		SourcePredicates: []string{"ABOUT"},
+		// the broader concepts of the locations are derived by the locationParents rule
+		ExcludeSourceTypes: []string{"Location"},
+		Relationship:       "HAS_BROADER",
+		Direction:          outgoing,
+		MinDepth:           1,
+		MaxDepth:           defaultMaxDepth,
+		Predicate:          "IMPLICITLY_ABOUT",
+		ExcludeExplicit:    true,
+	},
+	{
+		Name:             "organisationParents",
+		SourcePredicates: []string{"ABOUT"},
+		SourceType:       "Organisation",
+		Relationship:     "SUB_ORGANISATION_OF",
+		Direction:        outgoing,
+		TargetType:       "Organisation",
+		MinDepth:         1,
+		MaxDepth:         defaultMaxDepth,
+		Predicate:        "IMPLICITLY_ABOUT",
+		ExcludeExplicit:  true,
+	},
+	{
+		Name:             "locationParents",
+		SourcePredicates: []string{"ABOUT"},
+		SourceType:       "Location",
+		Relationship:     "HAS_BROADER",
+		Direction:        outgoing,
+		MinDepth:         1,
+		MaxDepth:         defaultMaxDepth,
+		Predicate:        "IMPLICITLY_ABOUT",
+		ExcludeExplicit:  true,
+	},
+}
+
+// LoadDerivationRules reads the implicit annotations derivation rules from a JSON file holding a list of rules,
+// and compiles them into the derivations passed to the driver with WithDerivationRules.
+// An empty path results in the default rules.
+func LoadDerivationRules(path string) ([]derivation, error) {
+	if path == "" {
+		return defaultDerivations, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading derivation rules %s: %w", path, err)
+	}
+	var rules []DerivationRule
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed parsing derivation rules %s: %w", path, err)
+	}
+	compiled, err := compileDerivations(rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid derivation rules %s: %w", path, err)
+	}
+	return compiled, nil
+}
+
+// compileDerivations returns the explicit annotations derivation followed by the ones compiled from the rules.
+func compileDerivations(rules []DerivationRule) ([]derivation, error) {
+	compiled := []derivation{explicitDerivation}
+	names := map[string]bool{explicitDerivation.name: true}
+	for _, rule := range rules {
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate derivation rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+
+		d, err := rule.compile()
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, d)
+	}
+	return compiled, nil
+}
+
+func (r DerivationRule) validate() error {
+	if !ruleNameRegex.MatchString(r.Name) {
+		return fmt.Errorf("invalid derivation rule name %q", r.Name)
+	}
+	for _, p := range r.SourcePredicates {
+		if _, ok := predicates[p]; !ok {
+			return fmt.Errorf("derivation rule %s: unknown source predicate %q", r.Name, p)
+		}
+	}
+	if r.SourceType != "" && !labelRegex.MatchString(r.SourceType) {
+		return fmt.Errorf("derivation rule %s: invalid source type %q", r.Name, r.SourceType)
+	}
+	for _, t := range r.ExcludeSourceTypes {
+		if !labelRegex.MatchString(t) {
+			return fmt.Errorf("derivation rule %s: invalid excluded source type %q", r.Name, t)
+		}
+	}
+	if !relationshipRegex.MatchString(r.Relationship) {
+		return fmt.Errorf("derivation rule %s: invalid relationship %q", r.Name, r.Relationship)
+	}
+	if r.Direction != outgoing && r.Direction != incoming {
+		return fmt.Errorf("derivation rule %s: direction should be %s or %s, got %q", r.Name, outgoing, incoming, r.Direction)
+	}
+	if r.TargetType != "" && !labelRegex.MatchString(r.TargetType) {
+		return fmt.Errorf("derivation rule %s: invalid target type %q", r.Name, r.TargetType)
+	}
+	if r.MinDepth < 0 || r.MaxDepth < 1 || r.MaxDepth < r.MinDepth {
+		return fmt.Errorf("derivation rule %s: invalid depth range %d..%d", r.Name, r.MinDepth, r.MaxDepth)
+	}
+	if _, ok := predicates[r.Predicate]; !ok {
+		return fmt.Errorf("derivation rule %s: unknown predicate %q", r.Name, r.Predicate)
+	}
+	return nil
+}
+
+// compile turns the rule into a derivation whose statement is formatted with the maximum depth of the traversal.
+func (r DerivationRule) compile() (derivation, error) {
+	if err := r.validate(); err != nil {
+		return derivation{}, err
+	}
+
+	sourceType := orConcept(r.SourceType)
+	targetType := orConcept(r.TargetType)
+	sourceRel := "rel"
+	explicitRel := ""
+	if len(r.SourcePredicates) > 0 {
+		sourceRel += ":" + strings.Join(r.SourcePredicates, "|")
+		explicitRel = "[:" + strings.Join(r.SourcePredicates, "|") + "]"
+	}
+	traversal := fmt.Sprintf("-[r:%s*%d..%%d]->", r.Relationship, r.MinDepth)
+	if r.Direction == incoming {
+		traversal = fmt.Sprintf("<-[r:%s*%d..%%d]-", r.Relationship, r.MinDepth)
+	}
+
+	var stmt strings.Builder
+	fmt.Fprintf(&stmt, `
+		MATCH (content:Content{uuid:{contentUUID}})-[%s]-(:Concept)-[:EQUIVALENT_TO]->(canonicalSource:Concept)
+		MATCH (canonicalSource)<-[:EQUIVALENT_TO]-(source:%s)%s(target:%s)-[:EQUIVALENT_TO]->(canonicalTarget:%s)`,
+		sourceRel, sourceType, traversal, targetType, targetType)
+	var conditions []string
+	if r.ExcludeExplicit {
+		conditions = append(conditions, fmt.Sprintf("NOT (canonicalTarget)<-[:EQUIVALENT_TO]-(:Concept)<-%s-(content)", explicitRel))
+	}
+	for _, t := range r.ExcludeSourceTypes {
+		conditions = append(conditions, "NOT source:"+t)
+	}
+	if len(conditions) > 0 {
+		fmt.Fprintf(&stmt, `
+		WHERE %s`, strings.Join(conditions, " AND "))
+	}
+	fmt.Fprintf(&stmt, `
+		RETURN
+			canonicalTarget.prefUUID as id,
+			canonicalTarget.isDeprecated as isDeprecated,
+			"%s" as predicate,
+			labels(canonicalTarget) as types,
+			canonicalTarget.prefLabel as prefLabel,
+			rel.lifecycle as lifecycle,
+			min(length(r)) as depth
+		`, r.Predicate)
+
+	return derivation{
+		name:      r.Name,
+		implicit:  true,
+		statement: stmt.String(),
+		maxDepth:  r.MaxDepth,
+		minDepth:  r.MinDepth,
+		concept:   "canonicalTarget",
+	}, nil
+}
+
+func orConcept(label string) string {
+	if label == "" {
+		return "Concept"
+	}
+	return label
+}
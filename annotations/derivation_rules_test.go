@@ -0,0 +1,164 @@
+package annotations
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDerivationRulesCompile(t *testing.T) {
+	tests := map[string]struct {
+		rule             DerivationRule
+		expectedFragment []string
+		excludedFragment []string
+	}{
+		"brandParents": {
+			rule: defaultDerivationRules[0],
+			expectedFragment: []string{
+				"MATCH (content:Content{uuid:{contentUUID}})-[rel]-(:Concept)-[:EQUIVALENT_TO]->(canonicalSource:Concept)",
+				"MATCH (canonicalSource)<-[:EQUIVALENT_TO]-(source:Brand)-[r:HAS_PARENT*0..%d]->(target:Brand)-[:EQUIVALENT_TO]->(canonicalTarget:Brand)",
+				`"IMPLICITLY_CLASSIFIED_BY" as predicate`,
+			},
+			excludedFragment: []string{"WHERE NOT"},
+		},
+		"impliedBy": {
+			rule: defaultDerivationRules[1],
+			expectedFragment: []string{
+				"MATCH (content:Content{uuid:{contentUUID}})-[rel:ABOUT]-(:Concept)-[:EQUIVALENT_TO]->(canonicalSource:Concept)",
+				"MATCH (canonicalSource)<-[:EQUIVALENT_TO]-(source:Topic)<-[r:IMPLIED_BY*1..%d]-(target:Brand)-[:EQUIVALENT_TO]->(canonicalTarget:Brand)",
+				`"IMPLICITLY_CLASSIFIED_BY" as predicate`,
+			},
+			excludedFragment: []string{"WHERE NOT"},
+		},
+		"broader": {
+			rule: defaultDerivationRules[2],
+			expectedFragment: []string{
+				"MATCH (content:Content{uuid:{contentUUID}})-[rel:ABOUT]-(:Concept)-[:EQUIVALENT_TO]->(canonicalSource:Concept)",
+				"MATCH (canonicalSource)<-[:EQUIVALENT_TO]-(source:Concept)-[r:HAS_BROADER*1..%d]->(target:Concept)-[:EQUIVALENT_TO]->(canonicalTarget:Concept)",
+				"WHERE NOT (canonicalTarget)<-[:EQUIVALENT_TO]-(:Concept)<-[:ABOUT]-(content) AND NOT source:Location",
+				`"IMPLICITLY_ABOUT" as predicate`,
+			},
+		},
+		"organisationParents": {
+			rule: defaultDerivationRules[3],
+			expectedFragment: []string{
+				"MATCH (content:Content{uuid:{contentUUID}})-[rel:ABOUT]-(:Concept)-[:EQUIVALENT_TO]->(canonicalSource:Concept)",
+				"MATCH (canonicalSource)<-[:EQUIVALENT_TO]-(source:Organisation)-[r:SUB_ORGANISATION_OF*1..%d]->(target:Organisation)-[:EQUIVALENT_TO]->(canonicalTarget:Organisation)",
+				"WHERE NOT (canonicalTarget)<-[:EQUIVALENT_TO]-(:Concept)<-[:ABOUT]-(content)",
+				`"IMPLICITLY_ABOUT" as predicate`,
+			},
+		},
+		"locationParents": {
+			rule: defaultDerivationRules[4],
+			expectedFragment: []string{
+				"MATCH (content:Content{uuid:{contentUUID}})-[rel:ABOUT]-(:Concept)-[:EQUIVALENT_TO]->(canonicalSource:Concept)",
+				"MATCH (canonicalSource)<-[:EQUIVALENT_TO]-(source:Location)-[r:HAS_BROADER*1..%d]->(target:Concept)-[:EQUIVALENT_TO]->(canonicalTarget:Concept)",
+				"WHERE NOT (canonicalTarget)<-[:EQUIVALENT_TO]-(:Concept)<-[:ABOUT]-(content)",
+				`"IMPLICITLY_ABOUT" as predicate`,
+			},
+		},
+		"rule with several source predicates": {
+			rule: DerivationRule{
+				Name:             "mentionedParents",
+				SourcePredicates: []string{"MENTIONS", "MAJOR_MENTIONS"},
+				Relationship:     "SUB_ORGANISATION_OF",
+				Direction:        outgoing,
+				TargetType:       "Organisation",
+				MinDepth:         1,
+				MaxDepth:         2,
+				Predicate:        "MENTIONS",
+				ExcludeExplicit:  true,
+			},
+			expectedFragment: []string{
+				"-[rel:MENTIONS|MAJOR_MENTIONS]-",
+				"(source:Concept)-[r:SUB_ORGANISATION_OF*1..%d]->(target:Organisation)",
+				"WHERE NOT (canonicalTarget)<-[:EQUIVALENT_TO]-(:Concept)<-[:MENTIONS|MAJOR_MENTIONS]-(content)",
+				`"MENTIONS" as predicate`,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d, err := tc.rule.compile()
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.rule.Name, d.name)
+			assert.True(t, d.implicit)
+			assert.Equal(t, tc.rule.MinDepth, d.minDepth)
+			assert.Equal(t, tc.rule.MaxDepth, d.maxDepth)
+			for _, fragment := range tc.expectedFragment {
+				assert.Contains(t, d.statement, fragment)
+			}
+			for _, fragment := range tc.excludedFragment {
+				assert.NotContains(t, d.statement, fragment)
+			}
+		})
+	}
+}
+
+func TestDerivationRulesValidation(t *testing.T) {
+	valid := defaultDerivationRules[2]
+	tests := map[string]func(r *DerivationRule){
+		"missing name":                 func(r *DerivationRule) { r.Name = "" },
+		"unknown source predicate":     func(r *DerivationRule) { r.SourcePredicates = []string{"LIKES"} },
+		"invalid source type":          func(r *DerivationRule) { r.SourceType = "Brand) DETACH DELETE (n" },
+		"invalid excluded source type": func(r *DerivationRule) { r.ExcludeSourceTypes = []string{"Location OR true"} },
+		"invalid relationship":         func(r *DerivationRule) { r.Relationship = "HAS_BROADER]-()" },
+		"invalid direction":            func(r *DerivationRule) { r.Direction = "both" },
+		"invalid target type":          func(r *DerivationRule) { r.TargetType = "topic" },
+		"negative minimum depth":       func(r *DerivationRule) { r.MinDepth = -1 },
+		"missing maximum depth":        func(r *DerivationRule) { r.MaxDepth = 0 },
+		"inverted depth range":         func(r *DerivationRule) { r.MinDepth, r.MaxDepth = 3, 2 },
+		"unknown predicate":            func(r *DerivationRule) { r.Predicate = "IMPLICITLY_LIKES" },
+	}
+
+	for name, invalidate := range tests {
+		t.Run(name, func(t *testing.T) {
+			rule := valid
+			invalidate(&rule)
+			_, err := rule.compile()
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := compileDerivations([]DerivationRule{valid, valid})
+	assert.Error(t, err, "duplicate rule names should be rejected")
+
+	explicit := valid
+	explicit.Name = "explicit"
+	_, err = compileDerivations([]DerivationRule{explicit})
+	assert.Error(t, err, "rules should not replace the explicit annotations")
+}
+
+func TestLoadDerivationRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "derivation-rules")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	valid := filepath.Join(dir, "valid.json")
+	require.NoError(t, ioutil.WriteFile(valid, []byte(`[{"name":"orgParents","sourcePredicates":["ABOUT"],"relationship":"SUB_ORGANISATION_OF","direction":"outgoing","minDepth":1,"maxDepth":3,"predicate":"IMPLICITLY_ABOUT"}]`), 0600))
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, ioutil.WriteFile(invalid, []byte(`[{"name":"orgParents","relationship":"SUB_ORGANISATION_OF","direction":"sideways","maxDepth":3,"predicate":"IMPLICITLY_ABOUT"}]`), 0600))
+
+	derivations, err := LoadDerivationRules(valid)
+	assert.NoError(t, err)
+	require.Len(t, derivations, 2)
+	assert.Equal(t, "explicit", derivations[0].name, "the explicit annotations should always be read first")
+	assert.Equal(t, "orgParents", derivations[1].name)
+
+	_, err = LoadDerivationRules(invalid)
+	assert.Error(t, err, "invalid rules should be rejected")
+
+	derivations, err = LoadDerivationRules("")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultDerivations, derivations)
+
+	derivations, err = LoadDerivationRules("../config/derivation-rules.json")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultDerivations, derivations, "the shipped rules should match the default ones")
+}
@@ -0,0 +1,59 @@
+package annotations
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// expansions defines the optional parts of the annotations that are only rendered when requested with the expand query parameter.
+var expansions = []expansion{
+	{name: "instruments", clear: func(a *annotation) { a.Instruments = nil }},
+	{name: "concept", clear: func(a *annotation) {
+		a.Aliases = nil
+		a.DescriptionXML = ""
+		a.ImageURL = ""
+		a.Strapline = ""
+		a.ScopeNote = ""
+	}},
+}
+
+type expansion struct {
+	name  string
+	clear func(*annotation)
+}
+
+// parseExpansions returns the expansions requested by the expand query parameter, e.g. expand=instruments.
+func parseExpansions(params url.Values) (map[string]bool, error) {
+	expand := map[string]bool{}
+	for _, param := range params["expand"] {
+		for _, name := range strings.Split(param, ",") {
+			if !isExpansion(name) {
+				return nil, fmt.Errorf("invalid expand value: %s", name)
+			}
+			expand[name] = true
+		}
+	}
+	return expand, nil
+}
+
+func isExpansion(name string) bool {
+	for _, e := range expansions {
+		if e.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// expandFields clears the optional parts of the annotations that were not requested.
+func expandFields(anns []annotation, expand map[string]bool) []annotation {
+	for i := range anns {
+		for _, e := range expansions {
+			if !expand[e.name] {
+				e.clear(&anns[i])
+			}
+		}
+	}
+	return anns
+}
@@ -0,0 +1,111 @@
+package annotations
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetHandlerExpandInstruments(t *testing.T) {
+	d := mockDriver{
+		readFunc: func(string, readOptions) (readResult, error) {
+			return readResult{anns: []annotation{{
+				Predicate: "http://www.ft.com/ontology/annotation/mentions",
+				ID:        "http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400",
+				FIGI:      "BB8000C3P0-R2D2",
+				Instruments: []instrument{
+					{FIGI: "BB8000C3P0-R2D2", Ticker: "FKB", Exchange: "XNAS", Primary: true},
+					{FIGI: "BB8000C3P0-R2D3", Ticker: "FKB", Exchange: "XETR"},
+				},
+			}}, found: true}, nil
+		},
+	}
+	tests := map[string]struct {
+		query              string
+		apiKey             string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		"instruments are not rendered unless requested": {
+			apiKey:             "partner-key",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `[{"predicate":"http://www.ft.com/ontology/annotation/mentions","id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400","apiUrl":"","types":null,"FIGI":"BB8000C3P0-R2D2"}]`,
+		},
+		"instruments are rendered with expand=instruments": {
+			query:              "?expand=instruments",
+			apiKey:             "partner-key",
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `[{"predicate":"http://www.ft.com/ontology/annotation/mentions","id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400","apiUrl":"","types":null,"FIGI":"BB8000C3P0-R2D2",
+				"instruments":[{"FIGI":"BB8000C3P0-R2D2","ticker":"FKB","exchange":"XNAS","primary":true},{"FIGI":"BB8000C3P0-R2D3","ticker":"FKB","exchange":"XETR"}]}]`,
+		},
+		"public callers do not see instruments": {
+			query:              "?expand=instruments",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `[{"predicate":"http://www.ft.com/ontology/annotation/mentions","id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400","apiUrl":"","types":null}]`,
+		},
+		"unknown expansions are rejected": {
+			query:              "?expand=instruments,everything",
+			apiKey:             "partner-key",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"message":"invalid query parameter"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			log := logger.NewUPPLogger("test-public-annotations-api", "PANIC")
+			hctx := NewHandlerCtx(d, "test-header", log)
+			r := mux.NewRouter()
+			r.HandleFunc("/content/{uuid}/annotations", GetAnnotations(hctx)).Methods("GET")
+
+			req := httptest.NewRequest("GET", fmt.Sprintf("/content/%s/annotations%s", knownUUID, tc.query), nil)
+			if tc.apiKey != "" {
+				req.Header.Set(apiKeyHeader, tc.apiKey)
+			}
+			rec := httptest.NewRecorder()
+			APIKeyMiddleware(testAccessConfig, log, r).ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			assert.JSONEq(t, tc.expectedBody, rec.Body.String())
+		})
+	}
+}
+
+func TestGetHandlerExpandConcept(t *testing.T) {
+	var conceptDetails bool
+	d := mockDriver{
+		readFunc: func(_ string, opts readOptions) (readResult, error) {
+			conceptDetails = opts.conceptDetails
+			ann := annotation{
+				Predicate: "http://www.ft.com/ontology/annotation/about",
+				ID:        "http://api.ft.com/things/ca982370-66cd-43bd-b2e3-7bfcb73efb1e",
+			}
+			if opts.conceptDetails {
+				ann.Aliases = []string{"Ashes 2017"}
+				ann.ImageURL = "http://example.com/ashes.jpg"
+				ann.Strapline = "England against Australia"
+			}
+			return readResult{anns: []annotation{ann}, found: true}, nil
+		},
+	}
+	log := logger.NewUPPLogger("test-public-annotations-api", "PANIC")
+	r := mux.NewRouter()
+	r.HandleFunc("/content/{uuid}/annotations", GetAnnotations(NewHandlerCtx(d, "test-header", log))).Methods("GET")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/content/%s/annotations?expand=concept", knownUUID), nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, conceptDetails, "the concept details should be read with the annotations")
+	assert.JSONEq(t, `[{"predicate":"http://www.ft.com/ontology/annotation/about","id":"http://api.ft.com/things/ca982370-66cd-43bd-b2e3-7bfcb73efb1e","apiUrl":"","types":null,
+		"aliases":["Ashes 2017"],"imageUrl":"http://example.com/ashes.jpg","strapline":"England against Australia"}]`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/content/%s/annotations", knownUUID), nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, conceptDetails, "the concept details should only be read when requested")
+}
@@ -0,0 +1,103 @@
+package annotations
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// annotationFields are the fields of the annotations that can be selected with the fields query parameter,
+// named as in the JSON of the annotations of the raw view.
+var annotationFields = jsonFieldNames(reflect.TypeOf(rawAnnotation{}))
+
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			names = append(names, jsonFieldNames(f.Type)...)
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" || f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// fieldset lists the fields of the annotations to render, in order. A nil fieldset renders all of them.
+type fieldset []string
+
+// parseFields reads the comma separated fields of the annotations to render, e.g. fields=id,prefLabel.
+func parseFields(values []string) (fieldset, error) {
+	var fields fieldset
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			if !containsString(annotationFields, name) {
+				return nil, fmt.Errorf("invalid fields value: %s", name)
+			}
+			if !containsString(fields, name) {
+				fields = append(fields, name)
+			}
+		}
+	}
+	return fields, nil
+}
+
+// project returns the annotation rendering only the fields of the fieldset, ann itself for a nil fieldset.
+func (f fieldset) project(ann interface{}) interface{} {
+	if f == nil {
+		return ann
+	}
+	return projectedAnnotation{ann: ann, fields: f}
+}
+
+// fieldValues returns the JSON of each field of the annotation, leaving out the empty fields omitted from its JSON.
+func fieldValues(ann interface{}) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(ann)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]json.RawMessage{}
+	if err = json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// projectedAnnotation renders the fields of an annotation selected by a fieldset, in the order of the fieldset.
+type projectedAnnotation struct {
+	ann    interface{}
+	fields fieldset
+}
+
+func (p projectedAnnotation) MarshalJSON() ([]byte, error) {
+	values, err := fieldValues(p.ann)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for _, name := range p.fields {
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
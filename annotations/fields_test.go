@@ -0,0 +1,136 @@
+package annotations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnotationFields(t *testing.T) {
+	for _, name := range []string{"predicate", "id", "apiUrl", "types", "leiCode", "prefLabel", "instruments", "lifecycle", "lifecycles", "scopeNote"} {
+		assert.Contains(t, annotationFields, name)
+	}
+	assert.NotContains(t, annotationFields, "Provenance", "the fields hidden from the JSON should not be selectable")
+	assert.NotContains(t, annotationFields, "-")
+}
+
+func TestParseFields(t *testing.T) {
+	tests := map[string]struct {
+		values        []string
+		expected      fieldset
+		expectedError bool
+	}{
+		"all fields": {},
+		"selected fields": {
+			values:   []string{"id,prefLabel", "predicate"},
+			expected: fieldset{"id", "prefLabel", "predicate"},
+		},
+		"duplicate fields": {
+			values:   []string{"id,id"},
+			expected: fieldset{"id"},
+		},
+		"unknown field": {
+			values:        []string{"id,title"},
+			expectedError: true,
+		},
+		"field named as in the model": {
+			values:        []string{"PrefLabel"},
+			expectedError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fields, err := parseFields(tc.values)
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, fields)
+		})
+	}
+}
+
+func TestProjectedAnnotation(t *testing.T) {
+	data, err := json.Marshal(fieldset{"prefLabel", "leiCode", "id"}.project(historyMSJ))
+	require.NoError(t, err)
+	assert.Equal(t, `{"prefLabel":"The Mall Street Journal","id":"http://api.ft.com/things/5d1510f8-2779-4b74-adab-0a5eb138fca6"}`, string(data),
+		"the fields should be rendered in order, without the empty ones")
+
+	var none fieldset
+	assert.Equal(t, historyMSJ, none.project(historyMSJ))
+}
+
+func TestGetHandlerWithFieldsQueryParam(t *testing.T) {
+	d := mockDriver{
+		readFunc: func(string, readOptions) (readResult, error) {
+			return readResult{anns: []annotation{historyFakebook, historyMSJ}, found: true}, nil
+		},
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/content/{uuid}/annotations", GetAnnotations(NewHandlerCtx(d, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC")))).Methods("GET")
+
+	tests := map[string]struct {
+		query              string
+		tier               string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		"selected fields": {
+			query:              "?fields=id,prefLabel&lifecycle=pac",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `[{"id":"http://api.ft.com/things/5d1510f8-2779-4b74-adab-0a5eb138fca6","prefLabel":"The Mall Street Journal"}]`,
+		},
+		"licensed field for the public": {
+			query:              "?fields=id,leiCode&lifecycle=v2",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `[{"id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400"}]`,
+		},
+		"lifecycle of the raw view": {
+			query:              "?fields=id,lifecycle&view=raw&lifecycle=v2",
+			tier:               partnerTier,
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `[{"id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400","lifecycle":"annotations-v2"}]`,
+		},
+		"grouped": {
+			query:              "?fields=prefLabel&groupBy=predicate",
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `{"http://www.ft.com/ontology/annotation/mentions":[{"prefLabel":"Fakebook, Inc."}],
+				"http://www.ft.com/ontology/annotation/about":[{"prefLabel":"The Mall Street Journal"}]}`,
+		},
+		"debug response": {
+			query:              "?fields=id&lifecycle=v1&debug=true",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"annotations":[],"debug":{"dropped":[],"missingDerivations":[],"filters":["lifecycle","importance","dedup"]}}`,
+		},
+		"unknown field": {
+			query:              "?fields=id,title",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"message":"invalid query parameter"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", fmt.Sprintf("/content/%s/annotations%s", knownUUID, tc.query), nil)
+			require.NoError(t, err)
+			if tc.tier != "" {
+				req = req.WithContext(context.WithValue(req.Context(), tierContextKey{}, tc.tier))
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			assert.JSONEq(t, tc.expectedBody, rec.Body.String())
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package annotations
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// groupings defines how the annotations are grouped with the groupBy query parameter, keyed by the name of the grouping.
+// Each returns the keys of the groups an annotation belongs to.
+var groupings = map[string]func(annotation) []string{
+	"predicate": func(a annotation) []string {
+		return []string{a.Predicate}
+	},
+	// types are ordered from the most generic to the most specific one
+	"type": func(a annotation) []string {
+		if len(a.Types) == 0 {
+			return nil
+		}
+		return []string{a.Types[len(a.Types)-1]}
+	},
+	// merged annotations belong to the group of each of their lifecycles
+	"lifecycle": func(a annotation) []string {
+		if len(a.Lifecycles) == 0 {
+			return []string{a.Lifecycle}
+		}
+		keys := make([]string, 0, len(a.Lifecycles))
+		for _, lc := range a.Lifecycles {
+			keys = append(keys, lc.Lifecycle)
+		}
+		return keys
+	},
+}
+
+// parseGroupBy reads the groupBy query parameter, empty by default for a flat list of annotations.
+func parseGroupBy(params url.Values) (string, error) {
+	values, ok := params["groupBy"]
+	if !ok {
+		return "", nil
+	}
+	if _, ok = groupings[values[0]]; !ok {
+		return "", fmt.Errorf("invalid groupBy value: %s", values[0])
+	}
+	return values[0], nil
+}
+
+// groupAnnotations groups the annotations with the given grouping, keeping their order within each group.
+func groupAnnotations(anns []annotation, groupBy string) map[string][]annotation {
+	groups := map[string][]annotation{}
+	for _, ann := range anns {
+		for _, key := range groupings[groupBy](ann) {
+			groups[key] = append(groups[key], ann)
+		}
+	}
+	return groups
+}
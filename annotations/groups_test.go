@@ -0,0 +1,145 @@
+package annotations
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupAnnotations(t *testing.T) {
+	v1Fakebook := historyFakebook
+	v1Fakebook.Lifecycle = "annotations-v1"
+	mergedMSJ := historyMSJ
+	mergedMSJ.Lifecycles = []annotationLifecycle{{Lifecycle: pacLifecycle}, {Lifecycle: v2Lifecycle}}
+	anns := []annotation{historyFakebook, mergedMSJ, v1Fakebook}
+
+	tests := map[string]struct {
+		groupBy  string
+		expected map[string][]annotation
+	}{
+		"by predicate": {
+			groupBy: "predicate",
+			expected: map[string][]annotation{
+				predicates["MENTIONS"]: {historyFakebook, v1Fakebook},
+				predicates["ABOUT"]:    {mergedMSJ},
+			},
+		},
+		"by most specific type": {
+			groupBy: "type",
+			expected: map[string][]annotation{
+				"http://www.ft.com/ontology/organisation/Organisation": {historyFakebook, mergedMSJ, v1Fakebook},
+			},
+		},
+		"by lifecycle": {
+			groupBy: "lifecycle",
+			expected: map[string][]annotation{
+				v2Lifecycle:      {historyFakebook, mergedMSJ},
+				pacLifecycle:     {mergedMSJ},
+				"annotations-v1": {v1Fakebook},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, groupAnnotations(anns, tc.groupBy))
+		})
+	}
+}
+
+func TestParseGroupBy(t *testing.T) {
+	for _, groupBy := range []string{"predicate", "type", "lifecycle"} {
+		actual, err := parseGroupBy(url.Values{"groupBy": {groupBy}})
+		assert.NoError(t, err)
+		assert.Equal(t, groupBy, actual)
+	}
+
+	actual, err := parseGroupBy(url.Values{})
+	assert.NoError(t, err)
+	assert.Empty(t, actual)
+
+	_, err = parseGroupBy(url.Values{"groupBy": {"prefLabel"}})
+	assert.Error(t, err)
+}
+
+func TestGetHandlerGroupBy(t *testing.T) {
+	d := mockDriver{
+		readFunc: func(string, readOptions) (readResult, error) {
+			return readResult{anns: []annotation{historyFakebook, historyMSJ}, found: true}, nil
+		},
+	}
+	r := mux.NewRouter()
+	r.HandleFunc("/content/{uuid}/annotations", GetAnnotations(NewHandlerCtx(d, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC")))).Methods("GET")
+
+	fakebook := `"id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400","apiUrl":"",
+		"types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/organisation/Organisation"],
+		"prefLabel":"Fakebook, Inc."`
+	msj := `"id":"http://api.ft.com/things/5d1510f8-2779-4b74-adab-0a5eb138fca6","apiUrl":"",
+		"types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/organisation/Organisation"],
+		"prefLabel":"The Mall Street Journal"`
+	tests := map[string]struct {
+		query              string
+		tier               string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		"grouped by predicate": {
+			query:              "?groupBy=predicate",
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `{"http://www.ft.com/ontology/annotation/mentions":[{"predicate":"http://www.ft.com/ontology/annotation/mentions",` + fakebook + `}],
+				"http://www.ft.com/ontology/annotation/about":[{"predicate":"http://www.ft.com/ontology/annotation/about",` + msj + `}]}`,
+		},
+		"grouped by lifecycle after the filters": {
+			query:              "?groupBy=lifecycle&lifecycle=pac",
+			tier:               partnerTier,
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"annotations-pac":[{"predicate":"http://www.ft.com/ontology/annotation/about",` + msj + `}]}`,
+		},
+		"grouped by lifecycle without a partner key": {
+			query:              "?groupBy=lifecycle",
+			tier:               publicTier,
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"message":"Grouping by lifecycle requires a partner API key"}`,
+		},
+		"grouped raw view": {
+			query:              "?groupBy=lifecycle&view=raw&lifecycle=v2",
+			tier:               partnerTier,
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `{"annotations-v2":[{"predicate":"http://www.ft.com/ontology/annotation/mentions",` + fakebook + `,
+				"leiCode":"BQ4BKCS1HXDV9TTTTTTTT","lifecycle":"annotations-v2"}]}`,
+		},
+		"grouped debug response": {
+			query:              "?groupBy=type&lifecycle=v1&debug=true",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"annotations":{},"debug":{"dropped":[],"missingDerivations":[],"filters":["lifecycle","importance","dedup"]}}`,
+		},
+		"invalid groupBy": {
+			query:              "?groupBy=concept",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"message":"invalid query parameter"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", fmt.Sprintf("/content/%s/annotations%s", knownUUID, tc.query), nil)
+			require.NoError(t, err)
+			if tc.tier != "" {
+				req = req.WithContext(context.WithValue(req.Context(), tierContextKey{}, tc.tier))
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			assert.JSONEq(t, tc.expectedBody, rec.Body.String())
+		})
+	}
+}
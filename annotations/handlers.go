@@ -2,26 +2,88 @@ package annotations
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/gorilla/mux"
 )
 
+// missingDerivationsHeader lists the implicit derivations left out of a partial response.
+const missingDerivationsHeader = "X-Annotations-Missing-Derivations"
+
+// Views of the annotations selected with the view query parameter, besides the default one.
+const (
+	// rawView returns every annotation of the content with its lifecycle, without the importance and lifecycle precedence rules
+	rawView = "raw"
+	// mergedView merges the annotations of the different lifecycles into one annotation listing its lifecycles and their provenance
+	mergedView = "merged"
+)
+
+var uuidRegex = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+
 // HandlerCtx contains objects needed from the annotations http handlers and is being passed to them as param
 type HandlerCtx struct {
 	AnnotationsDriver  driver
 	CacheControlHeader string
 	Log                *logger.UPPLogger
+
+	// history holds the annotations of the content over time, it is disabled when nil
+	history historyStore
+	// changes streams the changes of the annotations, it is disabled when nil
+	changes changeSource
+	// filters configures the filter chains of the routes
+	filters FiltersConfig
+
+	shuttingDown int32
+	shutdownOnce sync.Once
+	shutdown     chan struct{}
 }
 
-func NewHandlerCtx(d driver, ch string, log *logger.UPPLogger) *HandlerCtx {
-	return &HandlerCtx{
+func NewHandlerCtx(d driver, ch string, log *logger.UPPLogger, opts ...func(*HandlerCtx)) *HandlerCtx {
+	hctx := &HandlerCtx{
 		AnnotationsDriver:  d,
 		CacheControlHeader: ch,
 		Log:                log,
 	}
+	for _, opt := range opts {
+		opt(hctx)
+	}
+	return hctx
+}
+
+// WithHistory reads the annotations as of a point in time and lists their history from the given store.
+func WithHistory(store historyStore) func(*HandlerCtx) {
+	return func(hctx *HandlerCtx) {
+		hctx.history = store
+	}
+}
+
+// MarkShuttingDown makes the service report that it is not good to go,
+// so that it is taken out of load balancing while in-flight requests are drained.
+func (hctx *HandlerCtx) MarkShuttingDown() {
+	if atomic.CompareAndSwapInt32(&hctx.shuttingDown, 0, 1) {
+		close(hctx.shutdownSignal())
+	}
+}
+
+// shutdownSignal is closed when the service starts shutting down, so that long-lived responses can end.
+func (hctx *HandlerCtx) shutdownSignal() chan struct{} {
+	hctx.shutdownOnce.Do(func() {
+		hctx.shutdown = make(chan struct{})
+	})
+	return hctx.shutdown
+}
+
+func (hctx *HandlerCtx) isShuttingDown() bool {
+	return atomic.LoadInt32(&hctx.shuttingDown) == 1
 }
 
 // MethodNotAllowedHandler handles 405
@@ -32,63 +94,53 @@ func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
 
 func GetAnnotations(hctx *HandlerCtx) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		uuid := vars["uuid"]
-
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		if uuid == "" {
-			http.Error(w, "uuid required", http.StatusBadRequest)
-			return
+		debug, err := parseDebug(r.URL.Query())
+		var view, groupBy string
+		var fields fieldset
+		if err == nil {
+			view, err = parseView(r.URL.Query())
 		}
-
-		params := r.URL.Query()
-
-		var ok bool
-		var lifecycleParams []string
-		if lifecycleParams, ok = params["lifecycle"]; ok {
-			err := validateLifecycleParams(lifecycleParams)
-			if err != nil {
-				hctx.Log.WithError(err).Error("invalid query parameter")
-				w.WriteHeader(http.StatusBadRequest)
-				msg := `{"message":"invalid query parameter"}`
-				if _, err = w.Write([]byte(msg)); err != nil {
-					hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
-				}
-				return
-			}
+		if err == nil {
+			groupBy, err = parseGroupBy(r.URL.Query())
+		}
+		if err == nil {
+			fields, err = parseFields(r.URL.Query()["fields"])
 		}
-
-		annotations, found, err := hctx.AnnotationsDriver.read(uuid)
 		if err != nil {
-			hctx.Log.WithError(err).WithUUID(uuid).Error("failed getting annotations for content")
-			w.WriteHeader(http.StatusServiceUnavailable)
-			msg := fmt.Sprintf(`{"message":"Error getting annotations for content with uuid %s"}`, uuid)
+			hctx.Log.WithError(err).Error("invalid query parameter")
+			w.WriteHeader(http.StatusBadRequest)
+			msg := `{"message":"invalid query parameter"}`
 			if _, err = w.Write([]byte(msg)); err != nil {
 				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
 			}
 			return
 		}
-		if !found {
-			w.WriteHeader(http.StatusNotFound)
-			msg := fmt.Sprintf(`{"message":"No annotations found for content with uuid %s."}`, uuid)
-			if _, err = w.Write([]byte(msg)); err != nil {
-				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
-			}
+		// the views and the lifecycle groups reveal the lifecycles of the annotations
+		if view != "" && !hctx.requirePartnerTier(w, r, fmt.Sprintf("The %s view", view)) {
 			return
 		}
+		if groupBy == "lifecycle" && !hctx.requirePartnerTier(w, r, "Grouping by lifecycle") {
+			return
+		}
+		res, ok := hctx.readAnnotations(w, r, annotationsRoute, view)
+		if !ok {
+			return
+		}
+		res.groupBy = groupBy
+		res.fields = fields
 
-		lifecycleFilter := newLifecycleFilter(withLifecycles(lifecycleParams))
-		predicateFilter := NewAnnotationsPredicateFilter()
-		chain := newAnnotationsFilterChain(lifecycleFilter, predicateFilter)
-
-		annotations = chain.doNext(annotations)
+		body := res.render()
+		if debug {
+			body = newDebugResponse(res)
+		}
 
-		w.Header().Set("Cache-Control", hctx.CacheControlHeader)
+		hctx.setCacheHeaders(w, r, res)
 		w.WriteHeader(http.StatusOK)
 
-		if err = json.NewEncoder(w).Encode(annotations); err != nil {
+		if err = json.NewEncoder(w).Encode(body); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			msg := fmt.Sprintf(`{"message":"Error parsing annotations for content with uuid %s, err=%s"}`, uuid, err.Error())
+			msg := fmt.Sprintf(`{"message":"Error parsing annotations for content with uuid %s, err=%s"}`, res.uuid, err.Error())
 			hctx.Log.Error(msg)
 			if _, err = w.Write([]byte(msg)); err != nil {
 				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
@@ -97,6 +149,341 @@ func GetAnnotations(hctx *HandlerCtx) func(http.ResponseWriter, *http.Request) {
 	}
 }
 
+// filteredAnnotations are the annotations of a piece of content as served to the caller,
+// after the filters and the field restrictions of its tier are applied.
+type filteredAnnotations struct {
+	uuid               string
+	anns               []annotation
+	expand             map[string]bool
+	missingDerivations []string
+	dropped            []droppedAnnotation
+	filters            []string
+	view               string
+	// groupBy names the grouping of the annotations, empty for a flat list
+	groupBy string
+	// fields selects the fields of the annotations rendered, nil for all of them
+	fields fieldset
+}
+
+// render returns the annotations with the requested expansions, grouped when requested.
+func (res filteredAnnotations) render() interface{} {
+	anns := expandFields(res.anns, res.expand)
+	if res.groupBy == "" {
+		return renderView(anns, res.view, res.fields)
+	}
+	groups := map[string]interface{}{}
+	for key, group := range groupAnnotations(anns, res.groupBy) {
+		groups[key] = renderView(group, res.view, res.fields)
+	}
+	return groups
+}
+
+// renderView returns the annotations as rendered by the given view, with their lifecycle in the raw view,
+// and with only the fields of the fieldset.
+func renderView(anns []annotation, view string, fields fieldset) interface{} {
+	if view != rawView && fields == nil {
+		return anns
+	}
+	rendered := make([]interface{}, 0, len(anns))
+	for _, ann := range anns {
+		var item interface{} = ann
+		if view == rawView {
+			item = rawAnnotation{annotation: ann, Lifecycle: ann.Lifecycle}
+		}
+		rendered = append(rendered, fields.project(item))
+	}
+	return rendered
+}
+
+// debugResponse wraps the annotations with what was left out of them, for ?debug=true.
+type debugResponse struct {
+	Annotations interface{} `json:"annotations"`
+	Debug       debugInfo   `json:"debug"`
+}
+
+type debugInfo struct {
+	// Dropped lists the rows that could not be mapped to annotations
+	Dropped            []droppedAnnotation `json:"dropped"`
+	MissingDerivations []string            `json:"missingDerivations"`
+	// Filters names the filters applied to the annotations, in order
+	Filters []string `json:"filters"`
+}
+
+func newDebugResponse(res filteredAnnotations) debugResponse {
+	resp := debugResponse{
+		Annotations: res.render(),
+		Debug:       debugInfo{Dropped: res.dropped, MissingDerivations: res.missingDerivations, Filters: res.filters},
+	}
+	if anns, ok := resp.Annotations.([]annotation); ok && anns == nil {
+		resp.Annotations = []annotation{}
+	}
+	if resp.Debug.Dropped == nil {
+		resp.Debug.Dropped = []droppedAnnotation{}
+	}
+	if resp.Debug.MissingDerivations == nil {
+		resp.Debug.MissingDerivations = []string{}
+	}
+	if resp.Debug.Filters == nil {
+		resp.Debug.Filters = []string{}
+	}
+	return resp
+}
+
+// readAnnotations validates the request, reads the annotations of the content and filters them with the filters of the route
+// as adjusted for the given view, empty for the default one.
+// It writes the error response and returns false when the request cannot be served.
+func (hctx *HandlerCtx) readAnnotations(w http.ResponseWriter, r *http.Request, route string, view string) (filteredAnnotations, bool) {
+	vars := mux.Vars(r)
+
+	uuid, err := validateUUID(vars["uuid"])
+	if err != nil {
+		hctx.Log.WithError(err).Error("invalid path parameter")
+		w.WriteHeader(http.StatusBadRequest)
+		msg := `{"message":"invalid uuid path parameter"}`
+		if _, err = w.Write([]byte(msg)); err != nil {
+			hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+		}
+		return filteredAnnotations{}, false
+	}
+
+	params := r.URL.Query()
+
+	var ok bool
+	var lifecycleParams []string
+	if lifecycleParams, ok = params["lifecycle"]; ok {
+		err := validateLifecycleParams(lifecycleParams)
+		if err != nil {
+			hctx.Log.WithError(err).Error("invalid query parameter")
+			w.WriteHeader(http.StatusBadRequest)
+			msg := `{"message":"invalid query parameter"}`
+			if _, err = w.Write([]byte(msg)); err != nil {
+				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+			}
+			return filteredAnnotations{}, false
+		}
+	}
+
+	filters, err := hctx.filterChain(route, params)
+	if err != nil {
+		hctx.Log.WithError(err).Error("invalid query parameter")
+		w.WriteHeader(http.StatusBadRequest)
+		msg := `{"message":"invalid query parameter"}`
+		if _, err = w.Write([]byte(msg)); err != nil {
+			hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+		}
+		return filteredAnnotations{}, false
+	}
+	if !hctx.allowFilterToggles(w, r) {
+		return filteredAnnotations{}, false
+	}
+	if view == rawView {
+		filters = removeString(filters, "importance")
+	}
+
+	defaults := defaultReadOptions(hctx.AnnotationsDriver)
+	opts, err := parseReadOptions(params, defaults)
+	if err != nil {
+		hctx.Log.WithError(err).Error("invalid query parameter")
+		w.WriteHeader(http.StatusBadRequest)
+		msg := `{"message":"invalid query parameter"}`
+		if _, err = w.Write([]byte(msg)); err != nil {
+			hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+		}
+		return filteredAnnotations{}, false
+	}
+
+	expand, err := parseExpansions(params)
+	if err != nil {
+		hctx.Log.WithError(err).Error("invalid query parameter")
+		w.WriteHeader(http.StatusBadRequest)
+		msg := `{"message":"invalid query parameter"}`
+		if _, err = w.Write([]byte(msg)); err != nil {
+			hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+		}
+		return filteredAnnotations{}, false
+	}
+	opts.conceptDetails = expand["concept"]
+	opts.provenance = view == mergedView
+
+	asOfTime, err := parseAsOf(params, opts, defaults)
+	if err != nil {
+		hctx.Log.WithError(err).Error("invalid query parameter")
+		w.WriteHeader(http.StatusBadRequest)
+		msg := `{"message":"invalid query parameter"}`
+		if _, err = w.Write([]byte(msg)); err != nil {
+			hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+		}
+		return filteredAnnotations{}, false
+	}
+
+	var result readResult
+	if asOfTime.IsZero() {
+		result, err = hctx.AnnotationsDriver.read(uuid, opts)
+	} else {
+		result, err = hctx.readAsOf(uuid, asOfTime)
+	}
+	if errors.Is(err, errAsOfNotRetained) {
+		hctx.Log.WithError(err).Error("invalid query parameter")
+		w.WriteHeader(http.StatusBadRequest)
+		msg := `{"message":"invalid query parameter"}`
+		if _, err = w.Write([]byte(msg)); err != nil {
+			hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+		}
+		return filteredAnnotations{}, false
+	}
+	if errors.Is(err, errHistoryDisabled) {
+		w.WriteHeader(http.StatusNotImplemented)
+		msg := `{"message":"Annotations history is not enabled"}`
+		if _, err = w.Write([]byte(msg)); err != nil {
+			hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+		}
+		return filteredAnnotations{}, false
+	}
+	if err != nil {
+		hctx.Log.WithError(err).WithUUID(uuid).Error("failed getting annotations for content")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		msg := fmt.Sprintf(`{"message":"Error getting annotations for content with uuid %s"}`, uuid)
+		if _, err = w.Write([]byte(msg)); err != nil {
+			hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+		}
+		return filteredAnnotations{}, false
+	}
+	if !result.found {
+		w.WriteHeader(http.StatusNotFound)
+		msg := fmt.Sprintf(`{"message":"No annotations found for content with uuid %s."}`, uuid)
+		if _, err = w.Write([]byte(msg)); err != nil {
+			hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+		}
+		return filteredAnnotations{}, false
+	}
+
+	annotations := applyFilters(result.anns, filters, filterRequest{lifecycles: lifecycleParams, view: view})
+	annotations = restrictFields(annotations, tierFromRequest(r))
+
+	return filteredAnnotations{
+		uuid:               uuid,
+		anns:               annotations,
+		expand:             expand,
+		missingDerivations: result.missingDerivations,
+		dropped:            result.dropped,
+		filters:            filters,
+		view:               view,
+	}, true
+}
+
+// WithChangeSource streams the changes of the annotations from the given source.
+func WithChangeSource(source changeSource) func(*HandlerCtx) {
+	return func(hctx *HandlerCtx) {
+		hctx.changes = source
+	}
+}
+
+// WithFilters composes the filter chains of the routes from the given configuration.
+func WithFilters(cfg FiltersConfig) func(*HandlerCtx) {
+	return func(hctx *HandlerCtx) {
+		hctx.filters = cfg
+	}
+}
+
+// setCacheHeaders allows caching the response unless some of the implicit derivations are missing from it,
+// by the shared caches only for the public tier.
+func (hctx *HandlerCtx) setCacheHeaders(w http.ResponseWriter, r *http.Request, res filteredAnnotations) {
+	varyOnTier(w)
+	if len(res.missingDerivations) > 0 {
+		// partial responses should not be cached, the next request may get the complete annotations
+		hctx.Log.WithUUID(res.uuid).Warnf("Serving annotations without the %s derivations", strings.Join(res.missingDerivations, ", "))
+		w.Header().Set(missingDerivationsHeader, strings.Join(res.missingDerivations, ","))
+		w.Header().Set("Cache-Control", "no-store")
+		return
+	}
+	if res.view != "" {
+		// the views are only served to partners, shared caches must not serve them to other callers
+		w.Header().Set("Cache-Control", "private, no-store")
+		return
+	}
+	w.Header().Set("Cache-Control", tierCacheControl(r, hctx.CacheControlHeader))
+}
+
+// validateUUID checks that the given value is a well-formed UUID and returns it in lower case,
+// so that malformed ids are rejected before reaching neo4j.
+func validateUUID(uuid string) (string, error) {
+	if !uuidRegex.MatchString(uuid) {
+		return "", fmt.Errorf("invalid uuid: %q", uuid)
+	}
+	return strings.ToLower(uuid), nil
+}
+
+// parseReadOptions selects the implicit derivations to run among the default ones from the implicit and derive query parameters.
+// implicit=false skips all of them, while derive lists the ones to run, e.g. derive=brandParents,broader.
+// The depth query parameter limits how many levels of parent brands are returned.
+func parseReadOptions(params url.Values, defaults readOptions) (readOptions, error) {
+	opts := defaults
+
+	if values, ok := params["depth"]; ok {
+		depth, err := strconv.Atoi(values[0])
+		if err != nil || depth < 0 {
+			return opts, fmt.Errorf("invalid depth value: %s", values[0])
+		}
+		opts.maxDepths = map[string]int{"brandParents": depth}
+	}
+
+	implicit := true
+	if values, ok := params["implicit"]; ok {
+		var err error
+		if implicit, err = strconv.ParseBool(values[0]); err != nil {
+			return opts, fmt.Errorf("invalid implicit value: %s", values[0])
+		}
+	}
+
+	deriveParams, ok := params["derive"]
+	if !ok {
+		if !implicit {
+			opts.derivations = nil
+		}
+		return opts, nil
+	}
+	if !implicit {
+		return opts, errors.New("derive cannot be combined with implicit=false")
+	}
+
+	var names []string
+	for _, param := range deriveParams {
+		for _, name := range strings.Split(param, ",") {
+			if !containsString(defaults.derivations, name) {
+				return opts, fmt.Errorf("invalid derive value: %s", name)
+			}
+			names = append(names, name)
+		}
+	}
+	opts.derivations = names
+	return opts, nil
+}
+
+// parseDebug reads the debug query parameter, false by default.
+func parseDebug(params url.Values) (bool, error) {
+	values, ok := params["debug"]
+	if !ok {
+		return false, nil
+	}
+	debug, err := strconv.ParseBool(values[0])
+	if err != nil {
+		return false, fmt.Errorf("invalid debug value: %s", values[0])
+	}
+	return debug, nil
+}
+
+// parseView reads the view query parameter, empty by default.
+func parseView(params url.Values) (string, error) {
+	values, ok := params["view"]
+	if !ok {
+		return "", nil
+	}
+	if values[0] != rawView && values[0] != mergedView {
+		return "", fmt.Errorf("invalid view value: %s", values[0])
+	}
+	return values[0], nil
+}
+
 func validateLifecycleParams(lifecycleParams []string) error {
 	for _, lp := range lifecycleParams {
 		if _, ok := lifecycleMap[lp]; !ok {
@@ -2,10 +2,12 @@ package annotations
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/Financial-Times/go-logger/v2"
@@ -14,7 +16,8 @@ import (
 )
 
 const (
-	knownUUID = "12345"
+	knownUUID   = "3fc9fe3e-af8c-4f7f-961a-e5065392bb31"
+	unknownUUID = "3fc9fe3e-af8c-1a1a-961a-e5065392bb31"
 )
 
 func TestGetHandler(t *testing.T) {
@@ -29,8 +32,8 @@ func TestGetHandler(t *testing.T) {
 			name: "Success",
 			req:  newRequest("GET", fmt.Sprintf("/content/%s/annotations", knownUUID), "application/json", nil),
 			annotationsDriver: mockDriver{
-				readFunc: func(string) (anns annotations, found bool, err error) {
-					return []annotation{}, true, nil
+				readFunc: func(string, readOptions) (readResult, error) {
+					return readResult{anns: []annotation{}, found: true}, nil
 				},
 			},
 			expectedStatusCode: http.StatusOK,
@@ -38,25 +41,50 @@ func TestGetHandler(t *testing.T) {
 		},
 		{
 			name: "NotFound",
-			req:  newRequest("GET", fmt.Sprintf("/content/%s/annotations", "99999"), "application/json", nil),
+			req:  newRequest("GET", fmt.Sprintf("/content/%s/annotations", unknownUUID), "application/json", nil),
 			annotationsDriver: mockDriver{
-				readFunc: func(string) (anns annotations, found bool, err error) {
-					return []annotation{}, false, nil
+				readFunc: func(string, readOptions) (readResult, error) {
+					return readResult{anns: []annotation{}}, nil
 				},
 			},
 			expectedStatusCode: http.StatusNotFound,
-			expectedBody:       message("No annotations found for content with uuid 99999."),
+			expectedBody:       message("No annotations found for content with uuid 3fc9fe3e-af8c-1a1a-961a-e5065392bb31."),
+		},
+		{
+			name: "InvalidUUID",
+			req:  newRequest("GET", fmt.Sprintf("/content/%s/annotations", "12345"), "application/json", nil),
+			annotationsDriver: mockDriver{
+				readFunc: func(string, readOptions) (readResult, error) {
+					return readResult{}, errors.New("driver should not be called")
+				},
+			},
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       message("invalid uuid path parameter"),
+		},
+		{
+			name: "UpperCaseUUIDIsNormalised",
+			req:  newRequest("GET", fmt.Sprintf("/content/%s/annotations", strings.ToUpper(knownUUID)), "application/json", nil),
+			annotationsDriver: mockDriver{
+				readFunc: func(uuid string, _ readOptions) (readResult, error) {
+					if uuid != knownUUID {
+						return readResult{}, fmt.Errorf("unexpected uuid %s", uuid)
+					}
+					return readResult{anns: []annotation{}, found: true}, nil
+				},
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       "null",
 		},
 		{
 			name: "ReadError",
 			req:  newRequest("GET", fmt.Sprintf("/content/%s/annotations", knownUUID), "application/json", nil),
 			annotationsDriver: mockDriver{
-				readFunc: func(string) (anns annotations, found bool, err error) {
-					return nil, false, errors.New("TEST failing to READ")
+				readFunc: func(string, readOptions) (readResult, error) {
+					return readResult{}, errors.New("TEST failing to READ")
 				},
 			},
 			expectedStatusCode: http.StatusServiceUnavailable,
-			expectedBody:       message("Error getting annotations for content with uuid 12345"),
+			expectedBody:       message("Error getting annotations for content with uuid 3fc9fe3e-af8c-4f7f-961a-e5065392bb31"),
 		},
 	}
 
@@ -84,8 +112,8 @@ func TestGetHandlerWithLifecycleQueryParams(t *testing.T) {
 	}{
 		"request with valid lifecycle parameter should succeed": {
 			annotationsDriver: mockDriver{
-				readFunc: func(string) (anns annotations, found bool, err error) {
-					return []annotation{}, true, nil
+				readFunc: func(string, readOptions) (readResult, error) {
+					return readResult{anns: []annotation{}, found: true}, nil
 				},
 			},
 			lifecycleParams:    "lifecycle=pac",
@@ -94,8 +122,8 @@ func TestGetHandlerWithLifecycleQueryParams(t *testing.T) {
 		},
 		"request with invalid lifecycle parameter should fail": {
 			annotationsDriver: mockDriver{
-				readFunc: func(string) (anns annotations, found bool, err error) {
-					return []annotation{}, true, nil
+				readFunc: func(string, readOptions) (readResult, error) {
+					return readResult{anns: []annotation{}, found: true}, nil
 				},
 			},
 			lifecycleParams:    "lifecycle=invalid",
@@ -104,8 +132,8 @@ func TestGetHandlerWithLifecycleQueryParams(t *testing.T) {
 		},
 		"request with lifecycle parameters should apply additional filtering": {
 			annotationsDriver: mockDriver{
-				readFunc: func(string) (anns annotations, found bool, err error) {
-					return []annotation{pacAnnotationA, pacAnnotationB, v1AnnotationA, v1AnnotationB, v2AnnotationA, v2AnnotationB}, true, nil
+				readFunc: func(string, readOptions) (readResult, error) {
+					return readResult{anns: []annotation{pacAnnotationA, pacAnnotationB, v1AnnotationA, v1AnnotationB, v2AnnotationA, v2AnnotationB}, found: true}, nil
 				},
 			},
 			lifecycleParams:    "lifecycle=pac&lifecycle=v1",
@@ -139,6 +167,275 @@ func TestGetHandlerWithLifecycleQueryParams(t *testing.T) {
 	}
 }
 
+func TestGetHandlerWithDerivationQueryParams(t *testing.T) {
+	tests := map[string]struct {
+		queryParams         string
+		driverDerivations   []string
+		expectedStatusCode  int
+		expectedDerivations []string
+	}{
+		"request without parameters runs every derivation": {
+			expectedStatusCode:  http.StatusOK,
+			expectedDerivations: []string{"brandParents", "impliedBy", "broader", "organisationParents", "locationParents"},
+		},
+		"request with implicit=false skips implicit derivations": {
+			queryParams:        "implicit=false",
+			expectedStatusCode: http.StatusOK,
+		},
+		"request with derive runs the listed derivations": {
+			queryParams:         "derive=brandParents,broader",
+			expectedStatusCode:  http.StatusOK,
+			expectedDerivations: []string{"brandParents", "broader"},
+		},
+		"request with repeated derive parameters runs all listed derivations": {
+			queryParams:         "derive=impliedBy&derive=broader",
+			expectedStatusCode:  http.StatusOK,
+			expectedDerivations: []string{"impliedBy", "broader"},
+		},
+		"request without parameters runs every derivation of the driver": {
+			driverDerivations:   []string{"orgParents"},
+			expectedStatusCode:  http.StatusOK,
+			expectedDerivations: []string{"orgParents"},
+		},
+		"request with derive runs the listed derivations of the driver": {
+			queryParams:         "derive=orgParents",
+			driverDerivations:   []string{"orgParents", "broader"},
+			expectedStatusCode:  http.StatusOK,
+			expectedDerivations: []string{"orgParents"},
+		},
+		"request with a derivation the driver does not run should fail": {
+			queryParams:        "derive=brandParents",
+			driverDerivations:  []string{"orgParents"},
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"request with invalid depth should fail": {
+			queryParams:        "depth=-1",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"request with unknown derivation should fail": {
+			queryParams:        "derive=explicit",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"request with invalid implicit value should fail": {
+			queryParams:        "implicit=maybe",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"request combining derive with implicit=false should fail": {
+			queryParams:        "implicit=false&derive=broader",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var derivations []string
+			hctx := NewHandlerCtx(mockDriver{
+				readFunc: func(_ string, opts readOptions) (readResult, error) {
+					derivations = opts.derivations
+					return readResult{anns: []annotation{}, found: true}, nil
+				},
+				derivations: tc.driverDerivations,
+			}, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+
+			rec := httptest.NewRecorder()
+			r := mux.NewRouter()
+			r.HandleFunc("/content/{uuid}/annotations", GetAnnotations(hctx)).Methods("GET")
+			r.ServeHTTP(rec, newRequest("GET", fmt.Sprintf("/content/%s/annotations?%s", knownUUID, tc.queryParams), "application/json", nil))
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			assert.Equal(t, tc.expectedDerivations, derivations)
+		})
+	}
+}
+
+func TestGetHandlerWithDepthQueryParam(t *testing.T) {
+	var maxDepths map[string]int
+	hctx := NewHandlerCtx(mockDriver{
+		readFunc: func(_ string, opts readOptions) (readResult, error) {
+			maxDepths = opts.maxDepths
+			return readResult{anns: []annotation{{ID: "parent", Predicate: predicates["IMPLICITLY_CLASSIFIED_BY"], Depth: 2}}, found: true}, nil
+		},
+	}, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+
+	rec := httptest.NewRecorder()
+	r := mux.NewRouter()
+	r.HandleFunc("/content/{uuid}/annotations", GetAnnotations(hctx)).Methods("GET")
+	r.ServeHTTP(rec, newRequest("GET", fmt.Sprintf("/content/%s/annotations?depth=2", knownUUID), "application/json", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, map[string]int{"brandParents": 2}, maxDepths)
+	assert.JSONEq(t, `[{"predicate":"http://www.ft.com/ontology/implicitlyClassifiedBy","id":"parent","apiUrl":"","types":null,"depth":2}]`, rec.Body.String())
+}
+
+func TestGetHandlerPartialResponse(t *testing.T) {
+	hctx := NewHandlerCtx(mockDriver{
+		readFunc: func(string, readOptions) (readResult, error) {
+			return readResult{anns: []annotation{v2AnnotationA}, found: true, missingDerivations: []string{"impliedBy", "broader"}}, nil
+		},
+	}, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+
+	rec := httptest.NewRecorder()
+	r := mux.NewRouter()
+	r.HandleFunc("/content/{uuid}/annotations", GetAnnotations(hctx)).Methods("GET")
+	r.ServeHTTP(rec, newRequest("GET", fmt.Sprintf("/content/%s/annotations", knownUUID), "application/json", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "impliedBy,broader", rec.Header().Get(missingDerivationsHeader))
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"), "partial responses should not be cached")
+}
+
+func TestGetHandlerDebug(t *testing.T) {
+	hctx := NewHandlerCtx(mockDriver{
+		readFunc: func(string, readOptions) (readResult, error) {
+			return readResult{
+				anns:               []annotation{historyFakebook},
+				found:              true,
+				missingDerivations: []string{"broader"},
+				dropped:            []droppedAnnotation{{Reason: droppedUnknownType, ConceptID: "http://api.ft.com/things/unknown", Relationship: "MENTIONS"}},
+			}, nil
+		},
+	}, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+	r := mux.NewRouter()
+	r.HandleFunc("/content/{uuid}/annotations", GetAnnotations(hctx)).Methods("GET")
+
+	tests := map[string]struct {
+		query              string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		"debug section": {
+			query:              "?debug=true",
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `{"annotations":[{"predicate":"http://www.ft.com/ontology/annotation/mentions","id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400","apiUrl":"",
+				"types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/organisation/Organisation"],"prefLabel":"Fakebook, Inc."}],
+				"debug":{"dropped":[{"reason":"unknownType","conceptId":"http://api.ft.com/things/unknown","relationship":"MENTIONS"}],"missingDerivations":["broader"],
+					"filters":["lifecycle","importance","dedup"]}}`,
+		},
+		"without debug section": {
+			query:              "?debug=false",
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `[{"predicate":"http://www.ft.com/ontology/annotation/mentions","id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400","apiUrl":"",
+				"types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/organisation/Organisation"],"prefLabel":"Fakebook, Inc."}]`,
+		},
+		"invalid debug": {
+			query:              "?debug=yes-please",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"message":"invalid query parameter"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, newRequest("GET", fmt.Sprintf("/content/%s/annotations%s", knownUUID, tc.query), "application/json", nil))
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			assert.JSONEq(t, tc.expectedBody, rec.Body.String())
+		})
+	}
+}
+
+func TestGetHandlerViews(t *testing.T) {
+	msjMentions := historyMSJ
+	msjMentions.Predicate = predicates["MENTIONS"]
+	v1MSJ := historyMSJ
+	v1MSJ.Lifecycle = "annotations-v1"
+	hctx := NewHandlerCtx(mockDriver{
+		readFunc: func(_ string, opts readOptions) (readResult, error) {
+			pacMSJ := historyMSJ
+			if opts.provenance {
+				pacMSJ.Provenance = provenance{AnnotatedBy: "http://api.ft.com/things/0edd3c31-1fd0-4ef6-9230-8d545be3880a", RelevanceScore: 0.8}
+			}
+			return readResult{anns: []annotation{pacMSJ, msjMentions, v1MSJ, pacMSJ}, found: true}, nil
+		},
+	}, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+	r := mux.NewRouter()
+	r.HandleFunc("/content/{uuid}/annotations", GetAnnotations(hctx)).Methods("GET")
+
+	msj := `"id":"http://api.ft.com/things/5d1510f8-2779-4b74-adab-0a5eb138fca6","apiUrl":"",
+		"types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/organisation/Organisation"],
+		"prefLabel":"The Mall Street Journal"`
+	tests := map[string]struct {
+		query                string
+		tier                 string
+		expectedStatusCode   int
+		expectedBody         string
+		expectedCacheControl string
+	}{
+		"raw view for a partner": {
+			query:              "?view=raw",
+			tier:               partnerTier,
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `[{"predicate":"http://www.ft.com/ontology/annotation/about",` + msj + `,"lifecycle":"annotations-pac"},
+				{"predicate":"http://www.ft.com/ontology/annotation/mentions",` + msj + `,"lifecycle":"annotations-pac"},
+				{"predicate":"http://www.ft.com/ontology/annotation/about",` + msj + `,"lifecycle":"annotations-v1"}]`,
+			expectedCacheControl: "private, no-store",
+		},
+		"raw view of the requested lifecycles": {
+			query:                "?view=raw&lifecycle=v1",
+			tier:                 partnerTier,
+			expectedStatusCode:   http.StatusOK,
+			expectedBody:         `[{"predicate":"http://www.ft.com/ontology/annotation/about",` + msj + `,"lifecycle":"annotations-v1"}]`,
+			expectedCacheControl: "private, no-store",
+		},
+		"raw view with debug section": {
+			query:              "?view=raw&lifecycle=v1&debug=true",
+			tier:               partnerTier,
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `{"annotations":[{"predicate":"http://www.ft.com/ontology/annotation/about",` + msj + `,"lifecycle":"annotations-v1"}],
+				"debug":{"dropped":[],"missingDerivations":[],"filters":["lifecycle","dedup"]}}`,
+			expectedCacheControl: "private, no-store",
+		},
+		"merged view": {
+			query:              "?view=merged",
+			tier:               partnerTier,
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `[{"predicate":"http://www.ft.com/ontology/annotation/about",` + msj + `,"lifecycles":[
+				{"lifecycle":"annotations-pac","annotatedBy":"http://api.ft.com/things/0edd3c31-1fd0-4ef6-9230-8d545be3880a","relevanceScore":0.8},
+				{"lifecycle":"annotations-v1"}]}]`,
+			expectedCacheControl: "private, no-store",
+		},
+		"merged view of the requested lifecycles": {
+			query:                "?view=merged&lifecycle=v1",
+			tier:                 partnerTier,
+			expectedStatusCode:   http.StatusOK,
+			expectedBody:         `[{"predicate":"http://www.ft.com/ontology/annotation/about",` + msj + `,"lifecycles":[{"lifecycle":"annotations-v1"}]}]`,
+			expectedCacheControl: "private, no-store",
+		},
+		"merged view for the public": {
+			query:              "?view=merged",
+			tier:               publicTier,
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"message":"The merged view requires a partner API key"}`,
+		},
+		"raw view for the public": {
+			query:              "?view=raw",
+			tier:               publicTier,
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       `{"message":"The raw view requires a partner API key"}`,
+		},
+		"invalid view": {
+			query:              "?view=everything",
+			tier:               partnerTier,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"message":"invalid query parameter"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := newRequest("GET", fmt.Sprintf("/content/%s/annotations%s", knownUUID, tc.query), "application/json", nil)
+			req = req.WithContext(context.WithValue(req.Context(), tierContextKey{}, tc.tier))
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			assert.JSONEq(t, tc.expectedBody, rec.Body.String())
+			assert.Equal(t, tc.expectedCacheControl, rec.Header().Get("Cache-Control"))
+		})
+	}
+}
+
 func TestMethodeNotFound(t *testing.T) {
 	tests := []struct {
 		name               string
@@ -151,8 +448,8 @@ func TestMethodeNotFound(t *testing.T) {
 			name: "NotFound",
 			req:  newRequest("GET", fmt.Sprintf("/content/%s/annotations/", knownUUID), "application/json", nil),
 			annotationsDriver: mockDriver{
-				readFunc: func(string) (anns annotations, found bool, err error) {
-					return []annotation{}, true, nil
+				readFunc: func(string, readOptions) (readResult, error) {
+					return readResult{anns: []annotation{}, found: true}, nil
 				},
 			},
 			expectedStatusCode: http.StatusNotFound,
@@ -189,16 +486,28 @@ func message(errMsg string) string {
 }
 
 type mockDriver struct {
-	readFunc              func(string) (annotations, bool, error)
+	readFunc              func(string, readOptions) (readResult, error)
+	relatedFunc           func(string, []conceptWeight, int) ([]relatedContent, error)
 	checkConnectivityFunc func() error
+	missingIndexesFunc    func() ([]string, error)
+	// derivations are the implicit derivations of the driver, those of the default rules when nil
+	derivations []string
 }
 
-func (md mockDriver) read(contentUUID string) (annotations, bool, error) {
+func (md mockDriver) read(contentUUID string, opts readOptions) (readResult, error) {
 	if md.readFunc == nil {
-		return nil, false, errors.New("not implemented")
+		return readResult{}, errors.New("not implemented")
+	}
+
+	return md.readFunc(contentUUID, opts)
+}
+
+func (md mockDriver) related(contentUUID string, concepts []conceptWeight, limit int) ([]relatedContent, error) {
+	if md.relatedFunc == nil {
+		return nil, errors.New("not implemented")
 	}
 
-	return md.readFunc(contentUUID)
+	return md.relatedFunc(contentUUID, concepts, limit)
 }
 
 func (md mockDriver) checkConnectivity() error {
@@ -208,3 +517,18 @@ func (md mockDriver) checkConnectivity() error {
 
 	return md.checkConnectivityFunc()
 }
+
+func (md mockDriver) missingIndexes() ([]string, error) {
+	if md.missingIndexesFunc == nil {
+		return nil, errors.New("not implemented")
+	}
+
+	return md.missingIndexesFunc()
+}
+
+func (md mockDriver) implicitDerivations() []string {
+	if md.derivations == nil {
+		return NewCypherDriver(nil, "test").implicitDerivations()
+	}
+	return md.derivations
+}
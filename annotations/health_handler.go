@@ -1,6 +1,11 @@
 package annotations
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/Financial-Times/service-status-go/gtg"
 )
@@ -21,6 +26,30 @@ func HealthCheck(hctx *HandlerCtx) fthealth.Check {
 	}
 }
 
+func CanaryHealthCheck(hctx *HandlerCtx, contentUUID string, latencySLO time.Duration) fthealth.Check {
+	return fthealth.Check{
+		ID:               "canary-annotations-read",
+		BusinessImpact:   "Public Annotations api requests may be slow or fail",
+		Name:             "Check annotations of a known piece of content are read within the latency SLO",
+		PanicGuide:       runbookUrl,
+		Severity:         2,
+		TechnicalSummary: fmt.Sprintf(`Reading the annotations of content %s failed, found none or took longer than %s. If this check fails, check the load on Neo4j and that the canary content has not been deleted. You can find the canary uuid and latency SLO as parameters for this service.`, contentUUID, latencySLO),
+		Checker:          CanaryChecker(hctx.AnnotationsDriver, contentUUID, latencySLO),
+	}
+}
+
+func IndexesHealthCheck(hctx *HandlerCtx) fthealth.Check {
+	return fthealth.Check{
+		ID:               "neo4j-required-indexes",
+		BusinessImpact:   "Public Annotations api requests will be slow and put a high load on Neo4j",
+		Name:             "Check the indexes required by the annotations queries exist in Neo4j",
+		PanicGuide:       runbookUrl,
+		Severity:         2,
+		TechnicalSummary: fmt.Sprintf(`One of the indexes %s is missing or not online, so reads are doing full scans. If this check fails, check the indexes of Neo4j with "CALL db.indexes()" and recreate the missing ones.`, strings.Join(requiredIndexes, ", ")),
+		Checker:          IndexesChecker(hctx.AnnotationsDriver),
+	}
+}
+
 func Neo4jChecker(annDriver driver) func() (string, error) {
 	return func() (string, error) {
 		err := annDriver.checkConnectivity()
@@ -32,8 +61,44 @@ func Neo4jChecker(annDriver driver) func() (string, error) {
 	}
 }
 
+func CanaryChecker(annDriver driver, contentUUID string, latencySLO time.Duration) func() (string, error) {
+	return func() (string, error) {
+		start := time.Now()
+		result, err := annDriver.read(contentUUID, defaultReadOptions(annDriver))
+		elapsed := time.Since(start)
+		if err != nil {
+			return "Error reading canary annotations", err
+		}
+		if !result.found {
+			return "Canary annotations not found", fmt.Errorf("no annotations found for canary content %s", contentUUID)
+		}
+		if elapsed > latencySLO {
+			return "Canary annotations read too slowly", fmt.Errorf("reading canary annotations took %s, more than the SLO of %s", elapsed, latencySLO)
+		}
+
+		return fmt.Sprintf("Canary annotations read in %s", elapsed), nil
+	}
+}
+
+func IndexesChecker(annDriver driver) func() (string, error) {
+	return func() (string, error) {
+		missing, err := annDriver.missingIndexes()
+		if err != nil {
+			return "Error listing neo4j indexes", err
+		}
+		if len(missing) > 0 {
+			return "Required neo4j indexes are missing", errors.New("missing or offline indexes: " + strings.Join(missing, ", "))
+		}
+
+		return "Required neo4j indexes are present", nil
+	}
+}
+
 func GoodToGo(hctx *HandlerCtx) func() gtg.Status {
 	return func() gtg.Status {
+		if hctx.isShuttingDown() {
+			return gtg.Status{GoodToGo: false, Message: "Service is shutting down"}
+		}
 		if _, err := Neo4jChecker(hctx.AnnotationsDriver)(); err != nil {
 			return gtg.Status{GoodToGo: false, Message: err.Error()}
 		}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/Financial-Times/service-status-go/httphandlers"
@@ -90,3 +91,102 @@ func TestNeo4jConnectivityChecker_Unhealthy(t *testing.T) {
 	assert.Equal(t, "Error connecting to neo4j", message)
 	assert.Equal(t, "test error", err.Error())
 }
+
+func TestGTGShuttingDown(t *testing.T) {
+	req := httptest.NewRequest("GET", "/__gtg", nil)
+	annotationsDriver := mockDriver{
+		checkConnectivityFunc: func() error {
+			return nil
+		},
+	}
+	hctx := NewHandlerCtx(annotationsDriver, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+	hctx.MarkShuttingDown()
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(httphandlers.NewGoodToGoHandler(GoodToGo(hctx)))
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "status code")
+	assert.Equal(t, "Service is shutting down", rr.Body.String(), "GTG response body")
+}
+
+func TestCanaryChecker(t *testing.T) {
+	tests := map[string]struct {
+		readFunc        func(string, readOptions) (readResult, error)
+		latencySLO      time.Duration
+		expectedMessage string
+		expectedError   bool
+	}{
+		"canary read within the SLO is healthy": {
+			readFunc: func(string, readOptions) (readResult, error) {
+				return readResult{anns: annotations{{ID: "1"}}, found: true}, nil
+			},
+			latencySLO: time.Minute,
+		},
+		"canary read error is unhealthy": {
+			readFunc: func(string, readOptions) (readResult, error) {
+				return readResult{}, errors.New("test error")
+			},
+			latencySLO:      time.Minute,
+			expectedMessage: "Error reading canary annotations",
+			expectedError:   true,
+		},
+		"canary without annotations is unhealthy": {
+			readFunc: func(string, readOptions) (readResult, error) {
+				return readResult{}, nil
+			},
+			latencySLO:      time.Minute,
+			expectedMessage: "Canary annotations not found",
+			expectedError:   true,
+		},
+		"canary read slower than the SLO is unhealthy": {
+			readFunc: func(string, readOptions) (readResult, error) {
+				time.Sleep(10 * time.Millisecond)
+				return readResult{anns: annotations{{ID: "1"}}, found: true}, nil
+			},
+			latencySLO:      time.Millisecond,
+			expectedMessage: "Canary annotations read too slowly",
+			expectedError:   true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var readUUID string
+			annotationsDriver := mockDriver{
+				readFunc: func(uuid string, opts readOptions) (readResult, error) {
+					readUUID = uuid
+					return tc.readFunc(uuid, opts)
+				},
+			}
+			message, err := CanaryChecker(annotationsDriver, knownUUID, tc.latencySLO)()
+			assert.Equal(t, knownUUID, readUUID)
+			if tc.expectedError {
+				assert.Error(t, err)
+				assert.Equal(t, tc.expectedMessage, message)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestIndexesChecker(t *testing.T) {
+	healthy := mockDriver{
+		missingIndexesFunc: func() ([]string, error) {
+			return nil, nil
+		},
+	}
+	message, err := IndexesChecker(healthy)()
+	assert.NoError(t, err)
+	assert.Equal(t, "Required neo4j indexes are present", message)
+
+	missing := mockDriver{
+		missingIndexesFunc: func() ([]string, error) {
+			return []string{"INDEX ON :Content(uuid)"}, nil
+		},
+	}
+	message, err = IndexesChecker(missing)()
+	assert.Equal(t, "Required neo4j indexes are missing", message)
+	assert.EqualError(t, err, "missing or offline indexes: INDEX ON :Content(uuid)")
+}
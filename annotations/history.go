@@ -0,0 +1,188 @@
+package annotations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	errHistoryDisabled = errors.New("annotations history is not enabled")
+	errAsOfNotRetained = errors.New("asOf is older than the retention period of the annotations history")
+)
+
+// annotationsChange lists the annotations added and removed by a snapshot of the history.
+type annotationsChange struct {
+	Time    time.Time    `json:"time"`
+	Added   []annotation `json:"added,omitempty"`
+	Removed []annotation `json:"removed,omitempty"`
+}
+
+// parseAsOf reads the point in time to serve the annotations as of from the asOf query parameter, in RFC3339 format.
+// The history holds the complete annotations without their provenance, so asOf cannot be combined with options selecting
+// fewer annotations, concept details or the merged view.
+func parseAsOf(params url.Values, opts readOptions, defaults readOptions) (time.Time, error) {
+	values, ok := params["asOf"]
+	if !ok {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, values[0])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid asOf value: %s", values[0])
+	}
+	if !opts.complete(defaults) {
+		return time.Time{}, errors.New("asOf cannot be combined with implicit, derive, depth, expand=concept or view=merged")
+	}
+	return t, nil
+}
+
+// readAsOf returns the annotations of the content recorded at or before the given time.
+func (hctx *HandlerCtx) readAsOf(uuid string, t time.Time) (readResult, error) {
+	if hctx.history == nil {
+		return readResult{}, errHistoryDisabled
+	}
+	if t.Before(hctx.history.retainedSince()) {
+		return readResult{}, errAsOfNotRetained
+	}
+	snapshots, err := hctx.history.history(uuid)
+	if err != nil {
+		return readResult{}, err
+	}
+	snapshot, ok := asOf(snapshots, t)
+	if !ok || len(snapshot.Annotations) == 0 {
+		return readResult{}, nil
+	}
+	// the filters must not modify the annotations held by the store
+	anns := make(annotations, len(snapshot.Annotations))
+	copy(anns, snapshot.Annotations)
+	return readResult{anns: anns, found: true}, nil
+}
+
+// GetAnnotationsHistory lists the changes of the annotations of a piece of content over time,
+// as the annotations added and removed by each snapshot once filtered by the filters of the history route.
+func GetAnnotationsHistory(hctx *HandlerCtx) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		uuid, err := validateUUID(vars["uuid"])
+		if err != nil {
+			hctx.Log.WithError(err).Error("invalid path parameter")
+			w.WriteHeader(http.StatusBadRequest)
+			msg := `{"message":"invalid uuid path parameter"}`
+			if _, err = w.Write([]byte(msg)); err != nil {
+				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+			}
+			return
+		}
+
+		lifecycleParams := r.URL.Query()["lifecycle"]
+		err = validateLifecycleParams(lifecycleParams)
+		var filters []string
+		if err == nil {
+			filters, err = hctx.filterChain(historyRoute, r.URL.Query())
+		}
+		if err != nil {
+			hctx.Log.WithError(err).Error("invalid query parameter")
+			w.WriteHeader(http.StatusBadRequest)
+			msg := `{"message":"invalid query parameter"}`
+			if _, err = w.Write([]byte(msg)); err != nil {
+				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+			}
+			return
+		}
+		if !hctx.allowFilterToggles(w, r) {
+			return
+		}
+
+		if hctx.history == nil {
+			w.WriteHeader(http.StatusNotImplemented)
+			msg := `{"message":"Annotations history is not enabled"}`
+			if _, err = w.Write([]byte(msg)); err != nil {
+				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+			}
+			return
+		}
+
+		snapshots, err := hctx.history.history(uuid)
+		if err != nil {
+			hctx.Log.WithError(err).WithUUID(uuid).Error("failed getting annotations history for content")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			msg := fmt.Sprintf(`{"message":"Error getting annotations history for content with uuid %s"}`, uuid)
+			if _, err = w.Write([]byte(msg)); err != nil {
+				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+			}
+			return
+		}
+
+		changes := historyChanges(snapshots, func(anns []annotation) []annotation {
+			anns = applyFilters(anns, filters, filterRequest{lifecycles: lifecycleParams})
+			anns = restrictFields(anns, tierFromRequest(r))
+			return expandFields(anns, nil)
+		})
+		if len(changes) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			msg := fmt.Sprintf(`{"message":"No annotations history found for content with uuid %s."}`, uuid)
+			if _, err = w.Write([]byte(msg)); err != nil {
+				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+			}
+			return
+		}
+
+		varyOnTier(w)
+		w.Header().Set("Cache-Control", tierCacheControl(r, hctx.CacheControlHeader))
+		w.WriteHeader(http.StatusOK)
+
+		if err = json.NewEncoder(w).Encode(changes); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			msg := fmt.Sprintf(`{"message":"Error parsing annotations history for content with uuid %s, err=%s"}`, uuid, err.Error())
+			hctx.Log.Error(msg)
+			if _, err = w.Write([]byte(msg)); err != nil {
+				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+			}
+		}
+	}
+}
+
+// historyChanges compares every filtered snapshot with the previous one,
+// leaving out the snapshots whose changes are all filtered out.
+func historyChanges(snapshots []historySnapshot, filter func([]annotation) []annotation) []annotationsChange {
+	var changes []annotationsChange
+	var previous []annotation
+	for _, snapshot := range snapshots {
+		current := make([]annotation, len(snapshot.Annotations))
+		copy(current, snapshot.Annotations)
+		current = filter(current)
+
+		change := annotationsChange{
+			Time:    snapshot.Time,
+			Added:   missingFrom(previous, current),
+			Removed: missingFrom(current, previous),
+		}
+		if len(change.Added) > 0 || len(change.Removed) > 0 {
+			changes = append(changes, change)
+		}
+		previous = current
+	}
+	return changes
+}
+
+// missingFrom returns the annotations of candidates that are not in anns, by predicate and concept.
+func missingFrom(anns []annotation, candidates []annotation) []annotation {
+	present := map[string]bool{}
+	for _, ann := range anns {
+		present[ann.Predicate+"|"+ann.ID] = true
+	}
+	var missing []annotation
+	for _, ann := range candidates {
+		if !present[ann.Predicate+"|"+ann.ID] {
+			missing = append(missing, ann)
+		}
+	}
+	return missing
+}
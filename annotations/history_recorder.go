@@ -0,0 +1,90 @@
+package annotations
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// RecordHistory appends a snapshot of the annotations of every piece of content whose uuid is read from in, one per line,
+// to the annotations history file, unless they are the same as the latest snapshot of the content in the file.
+// The annotations are read as the annotations endpoint reads them before filtering, implicit annotations included,
+// so that the history serves what the annotations endpoint served at the time they were recorded.
+// It is fed the uuids of the content whose annotations were written, and has to be the only process appending to the file.
+func (hctx *HandlerCtx) RecordHistory(in io.Reader, path string) error {
+	latest := map[string][]annotation{}
+	file := &historyFile{path: path, log: hctx.Log}
+	err := file.readAppended(func(_ uint64, line historyLine) {
+		latest[line.UUID] = line.annotations()
+	})
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return fmt.Errorf("failed opening %s: %w", path, err)
+	}
+	defer out.Close()
+	info, err := out.Stat()
+	if err != nil {
+		return fmt.Errorf("failed reading %s: %w", path, err)
+	}
+	if info.Size() > file.offset {
+		// end the incomplete line left by an interrupted recording, so that it is skipped as invalid instead of corrupting the next one
+		if _, err = out.Write([]byte("\n")); err != nil {
+			return fmt.Errorf("failed writing %s: %w", path, err)
+		}
+	}
+
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		contentUUID := strings.TrimSpace(scanner.Text())
+		if contentUUID == "" {
+			continue
+		}
+		anns, err := hctx.readForHistory(contentUUID)
+		if err != nil {
+			hctx.Log.WithError(err).WithUUID(contentUUID).Error("Failed recording the annotations history of content")
+			continue
+		}
+		previous, recorded := latest[contentUUID]
+		if (!recorded && len(anns) == 0) || (recorded && sameAnnotations(previous, anns)) {
+			continue
+		}
+		data, err := json.Marshal(newHistoryLine(contentUUID, anns, time.Now().UTC()))
+		if err != nil {
+			return fmt.Errorf("failed recording the annotations history of content with uuid %s: %w", contentUUID, err)
+		}
+		// the line is written at once, so that the services following the file never read part of it
+		if _, err = out.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("failed writing %s: %w", path, err)
+		}
+		latest[contentUUID] = anns
+	}
+	return scanner.Err()
+}
+
+// readForHistory reads the annotations of the content with the default options of the annotations endpoint,
+// failing when some derivations are missing so that no incomplete snapshot is recorded.
+func (hctx *HandlerCtx) readForHistory(contentUUID string) ([]annotation, error) {
+	uuid, err := validateUUID(contentUUID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := hctx.AnnotationsDriver.read(uuid, defaultReadOptions(hctx.AnnotationsDriver))
+	if err != nil {
+		return nil, err
+	}
+	if len(result.missingDerivations) > 0 {
+		return nil, fmt.Errorf("annotations are missing the derivations %s", strings.Join(result.missingDerivations, ", "))
+	}
+	if !result.found {
+		return nil, nil
+	}
+	return result.anns, nil
+}
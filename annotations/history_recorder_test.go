@@ -0,0 +1,92 @@
+package annotations
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "annotations-history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	const (
+		unchangedUUID     = "6440aa4a-1298-4a49-9346-78d546bc0229"
+		changedUUID       = "c9ceb3a6-c8a2-4dfb-8d31-5a9a8b4d4c6a"
+		removedUUID       = "0d9a1ec5-3d6f-4b41-b3c9-5f2e5e9a1b3c"
+		notAnnotatedUUID  = "a4fe3f9c-2b21-4a4e-8f0d-2c4f6b1a7e58"
+		incompleteUUID    = "e2d8a5b1-7c3f-4e9a-9b6d-1f0c3a8e5d27"
+		failingUUID       = "f7b3c2d1-9e8a-4b6c-a5d4-3e2f1a0b9c8d"
+		invalidUUIDString = "12345"
+	)
+	var existing []byte
+	for _, line := range []historyLine{
+		newHistoryLine(unchangedUUID, []annotation{historyFakebook, historyMSJ}, historyStart),
+		newHistoryLine(changedUUID, []annotation{historyFakebook}, historyStart),
+		newHistoryLine(removedUUID, []annotation{historyMSJ}, historyStart),
+	} {
+		data, err := json.Marshal(line)
+		require.NoError(t, err)
+		existing = append(existing, append(data, '\n')...)
+	}
+	// an interrupted recording left an incomplete line
+	existing = append(existing, []byte(`{"uuid":"`+changedUUID+`","time":`)...)
+	require.NoError(t, ioutil.WriteFile(path, existing, 0600))
+
+	d := mockDriver{
+		readFunc: func(contentUUID string, opts readOptions) (readResult, error) {
+			assert.True(t, opts.complete(defaultReadOptions(mockDriver{})), "the complete annotations should be read")
+			switch contentUUID {
+			case unchangedUUID:
+				return readResult{anns: []annotation{historyMSJ, historyFakebook}, found: true}, nil
+			case changedUUID:
+				return readResult{anns: []annotation{historyFakebook, historyMSJ}, found: true}, nil
+			case incompleteUUID:
+				return readResult{anns: []annotation{historyMSJ}, found: true, missingDerivations: []string{"broader"}}, nil
+			case failingUUID:
+				return readResult{}, errors.New("neo4j is unavailable")
+			}
+			return readResult{}, nil
+		},
+	}
+	hctx := NewHandlerCtx(d, "", logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+
+	in := strings.Join([]string{unchangedUUID, changedUUID, removedUUID, notAnnotatedUUID, incompleteUUID, failingUUID, invalidUUIDString, "", changedUUID}, "\n")
+	require.NoError(t, hctx.RecordHistory(strings.NewReader(in), path))
+
+	store, err := NewFileHistoryStore(path, 0, logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+	require.NoError(t, err, "the history file should be readable")
+	expected := map[string][][]annotation{
+		unchangedUUID:    {{historyFakebook, historyMSJ}},
+		changedUUID:      {{historyFakebook}, {historyFakebook, historyMSJ}},
+		removedUUID:      {{historyMSJ}, {}},
+		notAnnotatedUUID: nil,
+		incompleteUUID:   nil,
+		failingUUID:      nil,
+	}
+	for contentUUID, expectedSnapshots := range expected {
+		snapshots, err := store.history(contentUUID)
+		require.NoError(t, err)
+		var anns [][]annotation
+		for _, snapshot := range snapshots {
+			anns = append(anns, snapshot.Annotations)
+		}
+		assert.Equal(t, expectedSnapshots, anns, "unexpected snapshots of content %s", contentUUID)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 6, strings.Count(string(data), "\n"), "only the changed annotations should be appended, after ending the incomplete line")
+
+	assert.Error(t, hctx.RecordHistory(strings.NewReader(changedUUID), filepath.Join(dir, "missing.jsonl")), "the file should exist")
+}
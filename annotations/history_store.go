@@ -0,0 +1,288 @@
+package annotations
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+// historyPruneInterval is how often the snapshots older than the retention period are dropped from memory.
+const historyPruneInterval = time.Hour
+
+// historyStore keeps the successive annotations of every piece of content, so they can be read as of a point in time.
+type historyStore interface {
+	// history returns the snapshots of the annotations of the content, the oldest first
+	history(contentUUID string) ([]historySnapshot, error)
+	// retainedSince returns the earliest time the annotations can be read as of, the zero time when the whole history is kept
+	retainedSince() time.Time
+}
+
+// historySnapshot holds the annotations of a piece of content from the time they were recorded until the next snapshot.
+type historySnapshot struct {
+	Time        time.Time
+	Annotations []annotation
+}
+
+// asOf returns the latest snapshot recorded at or before the given time.
+func asOf(snapshots []historySnapshot, t time.Time) (historySnapshot, bool) {
+	i := sort.Search(len(snapshots), func(i int) bool { return snapshots[i].Time.After(t) })
+	if i == 0 {
+		return historySnapshot{}, false
+	}
+	return snapshots[i-1], true
+}
+
+// sameAnnotations tells whether both lists hold the same annotations regardless of their order.
+func sameAnnotations(a, b []annotation) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	keys := map[string]int{}
+	for _, ann := range a {
+		keys[historyKey(ann)]++
+	}
+	for _, ann := range b {
+		key := historyKey(ann)
+		if keys[key] == 0 {
+			return false
+		}
+		keys[key]--
+	}
+	return true
+}
+
+func historyKey(ann annotation) string {
+	return ann.Predicate + "|" + ann.ID + "|" + ann.Lifecycle
+}
+
+// memoryHistoryStore keeps the history in memory, it is lost on restart.
+// Snapshots superseded before the retention period are dropped, a zero retention keeps the whole history.
+type memoryHistoryStore struct {
+	mu        sync.RWMutex
+	retention time.Duration
+	now       func() time.Time
+	snapshots map[string][]historySnapshot
+}
+
+func NewMemoryHistoryStore(retention time.Duration) *memoryHistoryStore {
+	return &memoryHistoryStore{retention: retention, now: time.Now, snapshots: make(map[string][]historySnapshot)}
+}
+
+// record appends a snapshot of the annotations of the content unless they are the same as the latest one,
+// returning whether it was appended.
+func (s *memoryHistoryStore) record(contentUUID string, anns []annotation, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshots := s.snapshots[contentUUID]
+	if len(snapshots) == 0 && len(anns) == 0 {
+		return false
+	}
+	if len(snapshots) > 0 {
+		latest := snapshots[len(snapshots)-1]
+		if sameAnnotations(latest.Annotations, anns) {
+			return false
+		}
+		if at.Before(latest.Time) {
+			at = latest.Time
+		}
+	}
+	stored := make([]annotation, len(anns))
+	copy(stored, anns)
+	s.snapshots[contentUUID] = append(snapshots, historySnapshot{Time: at, Annotations: stored})
+	if cutoff := s.retainedSince(); !cutoff.IsZero() {
+		s.pruneContent(contentUUID, cutoff)
+	}
+	return true
+}
+
+func (s *memoryHistoryStore) history(contentUUID string) ([]historySnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshots := make([]historySnapshot, len(s.snapshots[contentUUID]))
+	copy(snapshots, s.snapshots[contentUUID])
+	return snapshots, nil
+}
+
+func (s *memoryHistoryStore) retainedSince() time.Time {
+	if s.retention <= 0 {
+		return time.Time{}
+	}
+	return s.now().Add(-s.retention)
+}
+
+// prune drops the snapshots of every piece of content superseded before the retention period.
+func (s *memoryHistoryStore) prune() {
+	cutoff := s.retainedSince()
+	if cutoff.IsZero() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for contentUUID := range s.snapshots {
+		s.pruneContent(contentUUID, cutoff)
+	}
+}
+
+// pruneContent keeps the snapshots of the content recorded after the cutoff and the one in effect at the cutoff,
+// unless the annotations of the content were all removed before it. It must be called holding the lock.
+func (s *memoryHistoryStore) pruneContent(contentUUID string, cutoff time.Time) {
+	snapshots := s.snapshots[contentUUID]
+	i := sort.Search(len(snapshots), func(i int) bool { return snapshots[i].Time.After(cutoff) })
+	if i == 0 {
+		return
+	}
+	if i == len(snapshots) && len(snapshots[i-1].Annotations) == 0 {
+		delete(s.snapshots, contentUUID)
+		return
+	}
+	if i > 1 {
+		s.snapshots[contentUUID] = append([]historySnapshot(nil), snapshots[i-1:]...)
+	}
+}
+
+// fileHistoryStore follows the shared append-only JSON lines file where RecordHistory appends
+// the annotations of a piece of content every time they are written, one snapshot per line,
+// so that every replica following the file serves the same history.
+// The snapshots within the retention period are held in memory.
+type fileHistoryStore struct {
+	memory *memoryHistoryStore
+	file   *historyFile
+}
+
+// historyLine is the format of a snapshot in the history file.
+type historyLine struct {
+	UUID        string              `json:"uuid"`
+	Time        time.Time           `json:"time"`
+	Annotations []historyAnnotation `json:"annotations"`
+}
+
+// historyAnnotation also stores the lifecycle of the annotation, which is not rendered to the callers.
+type historyAnnotation struct {
+	annotation
+	Lifecycle string `json:"lifecycle"`
+}
+
+func newHistoryLine(contentUUID string, anns []annotation, at time.Time) historyLine {
+	line := historyLine{UUID: contentUUID, Time: at, Annotations: make([]historyAnnotation, len(anns))}
+	for i, ann := range anns {
+		line.Annotations[i] = historyAnnotation{annotation: ann, Lifecycle: ann.Lifecycle}
+	}
+	return line
+}
+
+func (l historyLine) annotations() []annotation {
+	anns := make([]annotation, len(l.Annotations))
+	for i, ha := range l.Annotations {
+		anns[i] = ha.annotation
+		anns[i].Lifecycle = ha.Lifecycle
+	}
+	return anns
+}
+
+// NewFileHistoryStore loads the snapshots already in the history file, which has to exist.
+// Watch has to be called for the store to follow the snapshots appended afterwards.
+func NewFileHistoryStore(path string, retention time.Duration, log *logger.UPPLogger) (*fileHistoryStore, error) {
+	s := &fileHistoryStore{memory: NewMemoryHistoryStore(retention), file: &historyFile{path: path, log: log}}
+	if err := s.poll(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *fileHistoryStore) history(contentUUID string) ([]historySnapshot, error) {
+	return s.memory.history(contentUUID)
+}
+
+func (s *fileHistoryStore) retainedSince() time.Time {
+	return s.memory.retainedSince()
+}
+
+// Watch polls the file for new snapshots at the given interval until the context is done,
+// and drops the snapshots older than the retention period from memory.
+func (s *fileHistoryStore) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(historyPruneInterval)
+	defer pruneTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.poll(); err != nil {
+				s.file.log.WithError(err).Error("failed reading annotations history")
+			}
+		case <-pruneTicker.C:
+			s.memory.prune()
+		}
+	}
+}
+
+func (s *fileHistoryStore) poll() error {
+	return s.file.readAppended(func(_ uint64, line historyLine) {
+		s.memory.record(line.UUID, line.annotations(), line.Time)
+	})
+}
+
+// historyFile follows a JSON lines file of snapshots of the annotations appended by other processes.
+type historyFile struct {
+	path   string
+	log    *logger.UPPLogger
+	offset int64
+	line   uint64
+}
+
+// readAppended passes the complete lines appended to the file since the previous read to apply, with their line number.
+// Invalid lines are logged and skipped, so that they do not hold up the following ones.
+func (f *historyFile) readAppended(apply func(number uint64, line historyLine)) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return fmt.Errorf("failed opening %s: %w", f.path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed reading %s: %w", f.path, err)
+	}
+	if info.Size() < f.offset {
+		// the file was truncated or replaced, keep numbering the lines after the ones already read
+		f.offset = 0
+	}
+	if _, err = file.Seek(f.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed reading %s: %w", f.path, err)
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// an incomplete line is read again once it is complete
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed reading %s: %w", f.path, err)
+		}
+		f.offset += int64(len(data))
+		f.line++
+
+		if len(data) == 1 {
+			continue
+		}
+		var line historyLine
+		if err = json.Unmarshal(data, &line); err != nil {
+			f.log.WithError(err).Errorf("Skipping invalid line %d of %s", f.line, f.path)
+			continue
+		}
+		apply(f.line, line)
+	}
+}
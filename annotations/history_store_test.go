@@ -0,0 +1,133 @@
+package annotations
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	historyFakebook = annotation{
+		Predicate: predicates["MENTIONS"],
+		ID:        "http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400",
+		Types:     []string{"http://www.ft.com/ontology/core/Thing", "http://www.ft.com/ontology/concept/Concept", "http://www.ft.com/ontology/organisation/Organisation"},
+		PrefLabel: "Fakebook, Inc.",
+		LeiCode:   "BQ4BKCS1HXDV9TTTTTTTT",
+		Lifecycle: v2Lifecycle,
+	}
+	historyMSJ = annotation{
+		Predicate: predicates["ABOUT"],
+		ID:        "http://api.ft.com/things/5d1510f8-2779-4b74-adab-0a5eb138fca6",
+		Types:     []string{"http://www.ft.com/ontology/core/Thing", "http://www.ft.com/ontology/concept/Concept", "http://www.ft.com/ontology/organisation/Organisation"},
+		PrefLabel: "The Mall Street Journal",
+		Lifecycle: pacLifecycle,
+	}
+	historyStart = time.Date(2020, 6, 1, 10, 0, 0, 0, time.UTC)
+)
+
+func TestMemoryHistoryStore(t *testing.T) {
+	store := NewMemoryHistoryStore(0)
+
+	assert.False(t, store.record(knownUUID, nil, historyStart), "content without annotations should not start a history")
+	assert.True(t, store.record(knownUUID, []annotation{historyFakebook}, historyStart))
+	assert.False(t, store.record(knownUUID, []annotation{historyFakebook}, historyStart.Add(time.Hour)), "unchanged annotations should not be recorded")
+	assert.True(t, store.record(knownUUID, []annotation{historyMSJ, historyFakebook}, historyStart.Add(2*time.Hour)))
+	assert.False(t, store.record(knownUUID, []annotation{historyFakebook, historyMSJ}, historyStart.Add(3*time.Hour)), "the order of the annotations should not matter")
+	assert.True(t, store.record(knownUUID, nil, historyStart.Add(4*time.Hour)), "removing all annotations should be recorded")
+
+	snapshots, err := store.history(knownUUID)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 3)
+	assert.Equal(t, historyStart, snapshots[0].Time)
+	assert.Equal(t, []annotation{historyFakebook}, snapshots[0].Annotations)
+
+	_, ok := asOf(snapshots, historyStart.Add(-time.Second))
+	assert.False(t, ok, "there should be no snapshot before the first one")
+	snapshot, ok := asOf(snapshots, historyStart.Add(90*time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, historyStart, snapshot.Time)
+	snapshot, ok = asOf(snapshots, historyStart.Add(2*time.Hour))
+	assert.True(t, ok)
+	assert.Len(t, snapshot.Annotations, 2, "a snapshot should apply from the time it was recorded")
+	snapshot, _ = asOf(snapshots, historyStart.Add(24*time.Hour))
+	assert.Empty(t, snapshot.Annotations)
+
+	snapshots, err = store.history(unknownUUID)
+	assert.NoError(t, err)
+	assert.Empty(t, snapshots)
+	assert.True(t, store.retainedSince().IsZero(), "the whole history should be kept without retention")
+}
+
+func TestMemoryHistoryStoreRetention(t *testing.T) {
+	now := historyStart.Add(3 * time.Hour)
+	store := NewMemoryHistoryStore(90 * time.Minute)
+	store.now = func() time.Time { return now }
+
+	store.record(knownUUID, []annotation{historyFakebook}, historyStart)
+	store.record(knownUUID, []annotation{historyFakebook, historyMSJ}, historyStart.Add(time.Hour))
+	store.record(knownUUID, []annotation{historyMSJ}, historyStart.Add(2*time.Hour))
+	store.record(unknownUUID, []annotation{historyMSJ}, historyStart)
+	store.record(unknownUUID, nil, historyStart.Add(time.Hour))
+	assert.True(t, historyStart.Add(90*time.Minute).Equal(store.retainedSince()))
+
+	snapshots, _ := store.history(knownUUID)
+	require.Len(t, snapshots, 2, "the snapshots superseded before the retention period should be dropped")
+	assert.Equal(t, historyStart.Add(time.Hour), snapshots[0].Time, "the snapshot in effect at the start of the retention period should be kept")
+	snapshots, _ = store.history(unknownUUID)
+	assert.Empty(t, snapshots, "content whose annotations were all removed before the retention period should be dropped")
+
+	now = now.Add(24 * time.Hour)
+	store.prune()
+	snapshots, _ = store.history(knownUUID)
+	require.Len(t, snapshots, 1, "the latest annotations should be kept however old")
+	assert.Equal(t, []annotation{historyMSJ}, snapshots[0].Annotations)
+}
+
+func TestFileHistoryStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "annotations-history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+
+	line := func(contentUUID string, anns []annotation, at time.Time) []byte {
+		data, err := json.Marshal(newHistoryLine(contentUUID, anns, at))
+		require.NoError(t, err)
+		return append(data, '\n')
+	}
+	appendToFile := func(data []byte) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		require.NoError(t, err)
+		_, err = f.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+
+	_, err = NewFileHistoryStore(path, 0, logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+	assert.Error(t, err, "the file should exist")
+
+	appendToFile(line(knownUUID, []annotation{historyFakebook}, historyStart))
+	store, err := NewFileHistoryStore(path, 0, logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+	require.NoError(t, err)
+
+	snapshots, err := store.history(knownUUID)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1, "the history should be loaded from the file")
+
+	appendToFile([]byte("not json\n"))
+	appendToFile(line(knownUUID, []annotation{historyFakebook, historyMSJ}, historyStart.Add(time.Hour)))
+	appendToFile(line(knownUUID, []annotation{historyMSJ, historyFakebook}, historyStart.Add(2*time.Hour)))
+	require.NoError(t, store.poll())
+
+	snapshots, err = store.history(knownUUID)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 2, "the snapshots appended should be followed, skipping invalid and unchanged ones")
+	assert.True(t, historyStart.Add(time.Hour).Equal(snapshots[1].Time))
+	assert.Equal(t, []annotation{historyFakebook, historyMSJ}, snapshots[1].Annotations, "the lifecycles should be read")
+}
@@ -0,0 +1,237 @@
+package annotations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetHandlerAsOfLeavesHistoryUnchanged(t *testing.T) {
+	store := NewMemoryHistoryStore(0)
+	store.record(knownUUID, []annotation{historyFakebook}, historyStart)
+	d := mockDriver{
+		readFunc: func(string, readOptions) (readResult, error) {
+			return readResult{anns: []annotation{historyMSJ}, found: true}, nil
+		},
+	}
+	hctx := NewHandlerCtx(d, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC"), WithHistory(store))
+	r := mux.NewRouter()
+	r.HandleFunc("/content/{uuid}/annotations", GetAnnotations(hctx)).Methods("GET")
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/content/%s/annotations%s", knownUUID, query), nil))
+		return rec
+	}
+
+	require.Equal(t, http.StatusOK, get("").Code)
+	rec := get("?asOf=" + historyStart.Add(time.Second).Format(time.RFC3339))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[{"predicate":"http://www.ft.com/ontology/annotation/mentions","id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400","apiUrl":"",
+		"types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/organisation/Organisation"],"prefLabel":"Fakebook, Inc."}]`, rec.Body.String())
+
+	snapshots, err := store.history(knownUUID)
+	require.NoError(t, err)
+	require.Len(t, snapshots, 1, "reads should not be recorded, the history is appended by RecordHistory")
+	assert.Equal(t, "BQ4BKCS1HXDV9TTTTTTTT", snapshots[0].Annotations[0].LeiCode, "restricting the fields served should not modify the history")
+}
+
+func TestGetHandlerAsOf(t *testing.T) {
+	store := NewMemoryHistoryStore(0)
+	store.record(knownUUID, []annotation{historyFakebook}, historyStart)
+	store.record(knownUUID, []annotation{historyFakebook, historyMSJ}, historyStart.Add(24*time.Hour))
+	retained := NewMemoryHistoryStore(24 * time.Hour)
+	retained.now = func() time.Time { return historyStart.Add(48 * time.Hour) }
+	retained.record(knownUUID, []annotation{historyFakebook}, historyStart)
+	retained.record(knownUUID, []annotation{historyFakebook, historyMSJ}, historyStart.Add(24*time.Hour))
+	d := mockDriver{
+		readFunc: func(string, readOptions) (readResult, error) {
+			return readResult{anns: []annotation{historyMSJ}, found: true}, nil
+		},
+	}
+
+	tests := map[string]struct {
+		query              string
+		tier               string
+		history            historyStore
+		expectedStatusCode int
+		expectedIDs        []string
+	}{
+		"annotations as of a time": {
+			query:              "?asOf=2020-06-01T12:00:00Z",
+			history:            store,
+			expectedStatusCode: http.StatusOK,
+			expectedIDs:        []string{historyFakebook.ID},
+		},
+		"annotations as of a later time": {
+			query:              "?asOf=2020-06-03T00:00:00%2B01:00",
+			history:            store,
+			expectedStatusCode: http.StatusOK,
+			expectedIDs:        []string{historyFakebook.ID, historyMSJ.ID},
+		},
+		"annotations as of a time filtered by lifecycle": {
+			query:              "?asOf=2020-06-03T00:00:00Z&lifecycle=pac",
+			history:            store,
+			expectedStatusCode: http.StatusOK,
+			expectedIDs:        []string{historyMSJ.ID},
+		},
+		"annotations as of a time before the history": {
+			query:              "?asOf=2020-05-01T00:00:00Z",
+			history:            store,
+			expectedStatusCode: http.StatusNotFound,
+		},
+		"annotations as of a time within the retention period": {
+			query:              "?asOf=2020-06-02T12:00:00Z",
+			history:            retained,
+			expectedStatusCode: http.StatusOK,
+			expectedIDs:        []string{historyFakebook.ID, historyMSJ.ID},
+		},
+		"annotations as of a time before the retention period": {
+			query:              "?asOf=2020-06-01T12:00:00Z",
+			history:            retained,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"invalid asOf": {
+			query:              "?asOf=last-week",
+			history:            store,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"asOf combined with implicit=false": {
+			query:              "?asOf=2020-06-01T12:00:00Z&implicit=false",
+			history:            store,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"asOf combined with expand=concept": {
+			query:              "?asOf=2020-06-01T12:00:00Z&expand=concept",
+			history:            store,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"asOf combined with view=merged": {
+			query:              "?asOf=2020-06-01T12:00:00Z&view=merged",
+			tier:               partnerTier,
+			history:            store,
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		"asOf without history": {
+			query:              "?asOf=2020-06-01T12:00:00Z",
+			expectedStatusCode: http.StatusNotImplemented,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var opts []func(*HandlerCtx)
+			if tc.history != nil {
+				opts = append(opts, WithHistory(tc.history))
+			}
+			hctx := NewHandlerCtx(d, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC"), opts...)
+			r := mux.NewRouter()
+			r.HandleFunc("/content/{uuid}/annotations", GetAnnotations(hctx)).Methods("GET")
+
+			req := httptest.NewRequest("GET", fmt.Sprintf("/content/%s/annotations%s", knownUUID, tc.query), nil)
+			if tc.tier != "" {
+				req = req.WithContext(context.WithValue(req.Context(), tierContextKey{}, tc.tier))
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			if tc.expectedIDs != nil {
+				assert.ElementsMatch(t, tc.expectedIDs, responseIDs(t, rec))
+			}
+		})
+	}
+}
+
+func TestGetAnnotationsHistory(t *testing.T) {
+	store := NewMemoryHistoryStore(0)
+	store.record(knownUUID, []annotation{historyFakebook}, historyStart)
+	store.record(knownUUID, []annotation{historyFakebook, historyMSJ}, historyStart.Add(24*time.Hour))
+	store.record(knownUUID, []annotation{historyMSJ}, historyStart.Add(48*time.Hour))
+
+	tests := map[string]struct {
+		uuid               string
+		query              string
+		history            historyStore
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		"history of the annotations": {
+			uuid:               knownUUID,
+			history:            store,
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `[
+				{"time":"2020-06-01T10:00:00Z","added":[{"predicate":"http://www.ft.com/ontology/annotation/mentions","id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400","apiUrl":"",
+					"types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/organisation/Organisation"],"prefLabel":"Fakebook, Inc."}]},
+				{"time":"2020-06-02T10:00:00Z","added":[{"predicate":"http://www.ft.com/ontology/annotation/about","id":"http://api.ft.com/things/5d1510f8-2779-4b74-adab-0a5eb138fca6","apiUrl":"",
+					"types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/organisation/Organisation"],"prefLabel":"The Mall Street Journal"}]},
+				{"time":"2020-06-03T10:00:00Z","removed":[{"predicate":"http://www.ft.com/ontology/annotation/mentions","id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400","apiUrl":"",
+					"types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/organisation/Organisation"],"prefLabel":"Fakebook, Inc."}]}
+			]`,
+		},
+		"history of the annotations filtered by lifecycle": {
+			uuid:               knownUUID,
+			query:              "?lifecycle=pac",
+			history:            store,
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `[
+				{"time":"2020-06-02T10:00:00Z","added":[{"predicate":"http://www.ft.com/ontology/annotation/about","id":"http://api.ft.com/things/5d1510f8-2779-4b74-adab-0a5eb138fca6","apiUrl":"",
+					"types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/organisation/Organisation"],"prefLabel":"The Mall Street Journal"}]}
+			]`,
+		},
+		"content without history": {
+			uuid:               unknownUUID,
+			history:            store,
+			expectedStatusCode: http.StatusNotFound,
+			expectedBody:       `{"message":"No annotations history found for content with uuid 3fc9fe3e-af8c-1a1a-961a-e5065392bb31."}`,
+		},
+		"invalid uuid": {
+			uuid:               "12345",
+			history:            store,
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"message":"invalid uuid path parameter"}`,
+		},
+		"history not enabled": {
+			uuid:               knownUUID,
+			expectedStatusCode: http.StatusNotImplemented,
+			expectedBody:       `{"message":"Annotations history is not enabled"}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var opts []func(*HandlerCtx)
+			if tc.history != nil {
+				opts = append(opts, WithHistory(tc.history))
+			}
+			hctx := NewHandlerCtx(mockDriver{}, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC"), opts...)
+			r := mux.NewRouter()
+			r.HandleFunc("/content/{uuid}/annotations/history", GetAnnotationsHistory(hctx)).Methods("GET")
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, httptest.NewRequest("GET", fmt.Sprintf("/content/%s/annotations/history%s", tc.uuid, tc.query), nil))
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			assert.JSONEq(t, tc.expectedBody, rec.Body.String())
+		})
+	}
+}
+
+func responseIDs(t *testing.T, rec *httptest.ResponseRecorder) []string {
+	var anns []annotation
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &anns))
+	var ids []string
+	for _, ann := range anns {
+		ids = append(ids, ann.ID)
+	}
+	return ids
+}
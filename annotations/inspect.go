@@ -0,0 +1,165 @@
+package annotations
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Formats of the annotations printed by PrintAnnotations.
+const (
+	JSONFormat = "json"
+	CSVFormat  = "csv"
+)
+
+// csvColumns are the fields of the annotations written as CSV when no fields are selected.
+var csvColumns = fieldset{"predicate", "id", "apiUrl", "types", "prefLabel", "lifecycle"}
+
+// PrintAnnotations reads the annotations of a piece of content and writes them filtered by the filters of the annotations route,
+// for the support engineers inspecting them from the command line. All the fields are written regardless of the access tiers,
+// unless some are selected as with the fields query parameter.
+func (hctx *HandlerCtx) PrintAnnotations(out io.Writer, contentUUID string, lifecycles []string, fields []string, format string) error {
+	if format != JSONFormat && format != CSVFormat {
+		return fmt.Errorf("invalid format %s, expected %s or %s", format, JSONFormat, CSVFormat)
+	}
+	selected, err := parseFields(fields)
+	if err != nil {
+		return err
+	}
+	result, err := hctx.inspect(contentUUID, lifecycles)
+	if err != nil {
+		return err
+	}
+	if len(result.missingDerivations) > 0 {
+		hctx.Log.WithUUID(contentUUID).Warnf("Annotations are missing the derivations %s", strings.Join(result.missingDerivations, ", "))
+	}
+	filters := hctx.filters.chain(annotationsRoute)
+	anns := expandFields(applyFilters(result.anns, filters, filterRequest{lifecycles: lifecycles}), nil)
+
+	if format == JSONFormat {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(renderView(anns, "", selected))
+	}
+	columns := csvColumns
+	if selected != nil {
+		columns = selected
+	}
+	w := csv.NewWriter(out)
+	if err = w.Write(columns); err != nil {
+		return err
+	}
+	for _, ann := range anns {
+		values, err := fieldValues(rawAnnotation{annotation: ann, Lifecycle: ann.Lifecycle})
+		if err != nil {
+			return err
+		}
+		record := make([]string, 0, len(columns))
+		for _, column := range columns {
+			record = append(record, csvValue(values[column]))
+		}
+		if err = w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// csvValue writes the JSON of a field as a CSV cell, strings as they are and lists of strings separated by spaces.
+func csvValue(value json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return s
+	}
+	var list []string
+	if err := json.Unmarshal(value, &list); err == nil {
+		return strings.Join(list, " ")
+	}
+	return string(value)
+}
+
+// ExplainAnnotations reads the annotations of a piece of content and writes which filter of the annotations route
+// drops each of them and why, followed by the annotations served. The rows that could not be mapped to annotations come first.
+func (hctx *HandlerCtx) ExplainAnnotations(out io.Writer, contentUUID string, lifecycles []string) error {
+	result, err := hctx.inspect(contentUUID, lifecycles)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	anns := result.anns
+	var rows []string
+	for _, dropped := range result.dropped {
+		rows = append(rows, explainRow("mapping", annotation{Predicate: dropped.Relationship, ID: dropped.ConceptID}, dropped.Reason))
+	}
+	// the filters of the route are run one at a time
+	for _, name := range hctx.filters.chain(annotationsRoute) {
+		stage, _ := lookupFilter(name)
+		filtered := applyFilters(anns, []string{name}, filterRequest{lifecycles: lifecycles})
+		kept, dropped := partitionAnnotations(anns, filtered)
+		for _, ann := range dropped {
+			rows = append(rows, explainRow(name, ann, stage.dropReason(ann, anns, filtered)))
+		}
+		anns = kept
+	}
+	for _, ann := range anns {
+		rows = append(rows, explainRow("served", ann, ""))
+	}
+
+	fmt.Fprintf(w, "Content %s: %d annotations read, %d served\n", contentUUID, len(result.anns)+len(result.dropped), len(anns))
+	if len(result.missingDerivations) > 0 {
+		fmt.Fprintf(w, "Missing derivations: %s\n", strings.Join(result.missingDerivations, ", "))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "STAGE\tPREDICATE\tCONCEPT\tPREFLABEL\tLIFECYCLE\tREASON")
+	for _, row := range rows {
+		fmt.Fprintln(w, row)
+	}
+	return w.Flush()
+}
+
+// inspect reads the annotations with the default options of the annotations endpoint.
+func (hctx *HandlerCtx) inspect(contentUUID string, lifecycles []string) (readResult, error) {
+	uuid, err := validateUUID(contentUUID)
+	if err != nil {
+		return readResult{}, err
+	}
+	if err = validateLifecycleParams(lifecycles); err != nil {
+		return readResult{}, err
+	}
+	result, err := hctx.AnnotationsDriver.read(uuid, defaultReadOptions(hctx.AnnotationsDriver))
+	if err != nil {
+		return readResult{}, fmt.Errorf("failed getting annotations for content with uuid %s: %w", uuid, err)
+	}
+	if !result.found {
+		return readResult{}, fmt.Errorf("no annotations found for content with uuid %s", uuid)
+	}
+	return result, nil
+}
+
+// partitionAnnotations splits the annotations of in between those kept in out and those dropped,
+// in the order of in since some filters do not preserve it.
+func partitionAnnotations(in []annotation, out []annotation) (kept []annotation, dropped []annotation) {
+	counts := map[string]int{}
+	for _, ann := range out {
+		counts[historyKey(ann)]++
+	}
+	for _, ann := range in {
+		key := historyKey(ann)
+		if counts[key] > 0 {
+			counts[key]--
+			kept = append(kept, ann)
+			continue
+		}
+		dropped = append(dropped, ann)
+	}
+	return kept, dropped
+}
+
+func explainRow(stage string, ann annotation, reason string) string {
+	return strings.Join([]string{stage, ann.Predicate, ann.ID, ann.PrefLabel, ann.Lifecycle, reason}, "\t")
+}
@@ -0,0 +1,119 @@
+package annotations
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintAnnotations(t *testing.T) {
+	d := mockDriver{
+		readFunc: func(string, readOptions) (readResult, error) {
+			return readResult{anns: []annotation{historyFakebook, historyMSJ}, found: true}, nil
+		},
+	}
+	hctx := NewHandlerCtx(d, "", logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+
+	var out bytes.Buffer
+	require.NoError(t, hctx.PrintAnnotations(&out, knownUUID, []string{"v2"}, nil, JSONFormat))
+	assert.JSONEq(t, `[{"predicate":"http://www.ft.com/ontology/annotation/mentions","id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400","apiUrl":"",
+		"types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/organisation/Organisation"],
+		"leiCode":"BQ4BKCS1HXDV9TTTTTTTT","prefLabel":"Fakebook, Inc."}]`, out.String(), "all the fields should be printed")
+
+	out.Reset()
+	require.NoError(t, hctx.PrintAnnotations(&out, knownUUID, nil, nil, CSVFormat))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "predicate,id,apiUrl,types,prefLabel,lifecycle", lines[0])
+	// the importance filter does not preserve the order of the annotations
+	assert.ElementsMatch(t, []string{
+		"http://www.ft.com/ontology/annotation/mentions,http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400,," +
+			"http://www.ft.com/ontology/core/Thing http://www.ft.com/ontology/concept/Concept http://www.ft.com/ontology/organisation/Organisation,\"Fakebook, Inc.\",annotations-v2",
+		"http://www.ft.com/ontology/annotation/about,http://api.ft.com/things/5d1510f8-2779-4b74-adab-0a5eb138fca6,," +
+			"http://www.ft.com/ontology/core/Thing http://www.ft.com/ontology/concept/Concept http://www.ft.com/ontology/organisation/Organisation,The Mall Street Journal,annotations-pac",
+	}, lines[1:])
+
+	out.Reset()
+	require.NoError(t, hctx.PrintAnnotations(&out, knownUUID, []string{"pac"}, []string{"prefLabel,lifecycle", "id"}, CSVFormat))
+	assert.Equal(t, "prefLabel,lifecycle,id\nThe Mall Street Journal,annotations-pac,http://api.ft.com/things/5d1510f8-2779-4b74-adab-0a5eb138fca6\n", out.String(),
+		"only the fields selected should be printed, in order")
+
+	out.Reset()
+	require.NoError(t, hctx.PrintAnnotations(&out, knownUUID, []string{"v2"}, []string{"id,types"}, JSONFormat))
+	assert.JSONEq(t, `[{"id":"http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400",
+		"types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/organisation/Organisation"]}]`, out.String())
+
+	assert.Error(t, hctx.PrintAnnotations(&out, knownUUID, nil, []string{"title"}, JSONFormat))
+	assert.Error(t, hctx.PrintAnnotations(&out, knownUUID, nil, nil, "xml"))
+	assert.Error(t, hctx.PrintAnnotations(&out, "12345", nil, nil, JSONFormat))
+	assert.Error(t, hctx.PrintAnnotations(&out, knownUUID, []string{"v3"}, nil, JSONFormat))
+}
+
+func TestPrintAnnotationsErrors(t *testing.T) {
+	tests := map[string]struct {
+		readFunc      func(string, readOptions) (readResult, error)
+		expectedError string
+	}{
+		"content not found": {
+			readFunc: func(string, readOptions) (readResult, error) {
+				return readResult{}, nil
+			},
+			expectedError: "no annotations found for content with uuid " + knownUUID,
+		},
+		"driver error": {
+			readFunc: func(string, readOptions) (readResult, error) {
+				return readResult{}, errors.New("neo4j unavailable")
+			},
+			expectedError: "failed getting annotations for content with uuid " + knownUUID + ": neo4j unavailable",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			hctx := NewHandlerCtx(mockDriver{readFunc: tc.readFunc}, "", logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+			err := hctx.PrintAnnotations(&bytes.Buffer{}, knownUUID, nil, nil, JSONFormat)
+			assert.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestExplainAnnotations(t *testing.T) {
+	msjMentions := historyMSJ
+	msjMentions.Predicate = predicates["MENTIONS"]
+	v1Fakebook := historyFakebook
+	v1Fakebook.Lifecycle = "annotations-v1"
+	d := mockDriver{
+		readFunc: func(string, readOptions) (readResult, error) {
+			return readResult{
+				anns:               []annotation{historyFakebook, historyMSJ, msjMentions, v1Fakebook, historyMSJ},
+				found:              true,
+				missingDerivations: []string{"brandParents"},
+				dropped:            []droppedAnnotation{{Reason: droppedUnknownPredicate, ConceptID: "http://api.ft.com/things/unknown", Relationship: "UNKNOWN"}},
+			}, nil
+		},
+	}
+	hctx := NewHandlerCtx(d, "", logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+
+	var out bytes.Buffer
+	require.NoError(t, hctx.ExplainAnnotations(&out, knownUUID, nil))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 10)
+	assert.Equal(t, "Content "+knownUUID+": 6 annotations read, 2 served", lines[0])
+	assert.Equal(t, "Missing derivations: brandParents", lines[1])
+	assert.Equal(t, []string{"STAGE", "PREDICATE", "CONCEPT", "PREFLABEL", "LIFECYCLE", "REASON"}, strings.Fields(lines[3]))
+	assert.Regexp(t, `^mapping +UNKNOWN +http://api.ft.com/things/unknown +unknownPredicate$`, lines[4])
+	assert.Regexp(t, `^lifecycle .*annotations-v1 +PAC annotations supersede the other lifecycles$`, lines[5])
+	assert.Regexp(t, `^importance +http://www.ft.com/ontology/annotation/mentions +http://api.ft.com/things/5d1510f8.* a more important predicate annotates the same concept$`, lines[6])
+	assert.Regexp(t, `^importance +http://www.ft.com/ontology/annotation/about .* duplicate of another annotation$`, lines[7])
+	assert.Regexp(t, `^served +http://www.ft.com/ontology/annotation/mentions +http://api.ft.com/things/eac853f5`, lines[8])
+	assert.Regexp(t, `^served +http://www.ft.com/ontology/annotation/about +http://api.ft.com/things/5d1510f8`, lines[9])
+
+	out.Reset()
+	require.NoError(t, hctx.ExplainAnnotations(&out, knownUUID, []string{"pac"}))
+	assert.Contains(t, out.String(), "lifecycle not requested")
+}
@@ -13,6 +13,54 @@ type annotation struct {
 	//used for filtering, e.g. pac not exposed
 	Lifecycle    string `json:"-"`
 	IsDeprecated bool   `json:"isDeprecated,omitempty"`
+	// depth of the hierarchy at which an implicit annotation was reached
+	Depth int `json:"depth,omitempty"`
+	// financial instruments issued by the concept, only rendered with expand=instruments
+	Instruments []instrument `json:"instruments,omitempty"`
+	// details of the concept, only rendered with expand=concept
+	Aliases        []string `json:"aliases,omitempty"`
+	DescriptionXML string   `json:"descriptionXML,omitempty"`
+	ImageURL       string   `json:"imageUrl,omitempty"`
+	Strapline      string   `json:"strapline,omitempty"`
+	ScopeNote      string   `json:"scopeNote,omitempty"`
+	// provenance of the annotation in its lifecycle
+	Provenance provenance `json:"-"`
+	// lifecycles the annotation was merged from, only rendered with view=merged
+	Lifecycles []annotationLifecycle `json:"lifecycles,omitempty"`
+}
+
+// provenance describes who annotated the content with a concept and how relevant the concept is, when known.
+type provenance struct {
+	AnnotatedBy     string  `json:"annotatedBy,omitempty"`
+	AnnotatedDate   string  `json:"annotatedDate,omitempty"`
+	RelevanceScore  float64 `json:"relevanceScore,omitempty"`
+	ConfidenceScore float64 `json:"confidenceScore,omitempty"`
+}
+
+// annotationLifecycle is a lifecycle of a merged annotation, with the provenance of the annotation in that lifecycle.
+type annotationLifecycle struct {
+	Lifecycle string `json:"lifecycle"`
+	provenance
+}
+
+// rawAnnotation is an annotation of the raw view, rendered with its lifecycle.
+type rawAnnotation struct {
+	annotation
+	Lifecycle string `json:"lifecycle"`
+}
+
+// droppedAnnotation describes a row of the annotations queries that could not be mapped to an annotation.
+type droppedAnnotation struct {
+	Reason       string `json:"reason"`
+	ConceptID    string `json:"conceptId"`
+	Relationship string `json:"relationship"`
+}
+
+type instrument struct {
+	FIGI     string `json:"FIGI"`
+	Ticker   string `json:"ticker,omitempty"`
+	Exchange string `json:"exchange,omitempty"`
+	Primary  bool   `json:"primary,omitempty"`
 }
 
 var predicates = map[string]string{
@@ -28,3 +76,19 @@ var predicates = map[string]string{
 	"IMPLICITLY_CLASSIFIED_BY":   "http://www.ft.com/ontology/implicitlyClassifiedBy",
 	"IMPLICITLY_ABOUT":           "http://www.ft.com/ontology/implicitlyAbout",
 }
+
+type relatedContent struct {
+	ID     string  `json:"id"`
+	APIURL string  `json:"apiUrl"`
+	Score  float64 `json:"score"`
+	// SharedConcepts are the concepts both pieces of content are annotated with, the heaviest first
+	SharedConcepts []sharedConcept `json:"sharedConcepts"`
+}
+
+type sharedConcept struct {
+	ID        string   `json:"id"`
+	APIURL    string   `json:"apiUrl"`
+	Types     []string `json:"types"`
+	PrefLabel string   `json:"prefLabel,omitempty"`
+	Weight    float64  `json:"weight"`
+}
@@ -0,0 +1,165 @@
+package annotations
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/rcrowley/go-metrics"
+)
+
+const sweepInterval = time.Minute
+
+// RateLimit configures the token bucket of every client of a tier.
+// Rate is the number of requests per second the bucket is refilled with, Burst is its capacity.
+// A tier without a rate is not limited.
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	limit  RateLimit
+}
+
+// refilledBy tells whether the bucket would be full again by the given time, however many tokens it had left.
+func (b *tokenBucket) refilledBy(now time.Time) bool {
+	return now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst)
+}
+
+// RateLimiter keeps a token bucket per client, where a client is identified by its API key or, without one, by its IP.
+type RateLimiter struct {
+	mu        sync.Mutex
+	limits    map[string]RateLimit
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+	registry  metrics.Registry
+	// trustedProxyHops is the number of proxies in front of the service appending the address of their client to X-Forwarded-For
+	trustedProxyHops int
+}
+
+func NewRateLimiter(cfg AccessConfig, registry metrics.Registry, opts ...func(*RateLimiter)) *RateLimiter {
+	l := &RateLimiter{
+		limits:    cfg.Tiers,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+		registry:  registry,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// WithTrustedProxyHops identifies the clients without an API key by the address X-Forwarded-For got from the outermost
+// of the given number of trusted proxies, instead of the address of the connection.
+func WithTrustedProxyHops(hops int) func(*RateLimiter) {
+	return func(l *RateLimiter) {
+		l.trustedProxyHops = hops
+	}
+}
+
+// allow takes a token from the bucket of the client and reports how many are left.
+// When the bucket is empty it returns how long the client has to wait for the next token.
+func (l *RateLimiter) allow(client string, limit RateLimit) (remaining int, retryAfter time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+
+	b, found := l.buckets[client]
+	if !found {
+		b = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	b.limit = limit
+
+	if b.tokens < 1 {
+		wait := (1 - b.tokens) / limit.Rate
+		return 0, time.Duration(wait * float64(time.Second)), false
+	}
+	b.tokens--
+	return int(b.tokens), 0, true
+}
+
+// sweep drops the buckets of clients that have been idle long enough for them to be full again,
+// i.e. for longer than burst/rate, as a new bucket would be the same by the time of their next request.
+func (l *RateLimiter) sweep(now time.Time) {
+	for client, b := range l.buckets {
+		if b.refilledBy(now) {
+			delete(l.buckets, client)
+		}
+	}
+	l.lastSweep = now
+}
+
+// RateLimitMiddleware throttles clients according to the rate limit of their tier, responding with 429 when they exceed it.
+// It relies on the tier being resolved by APIKeyMiddleware beforehand.
+func RateLimitMiddleware(l *RateLimiter, log *logger.UPPLogger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tier := tierFromRequest(r)
+		limit, ok := l.limits[tier]
+		if !ok || limit.Rate <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		remaining, retryAfter, allowed := l.allow(clientID(r, l.trustedProxyHops), limit)
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if allowed {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		metrics.GetOrRegisterCounter("ratelimit.throttled", l.registry).Inc(1)
+		metrics.GetOrRegisterCounter("ratelimit.throttled."+tier, l.registry).Inc(1)
+
+		retrySeconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+		w.Header().Set("X-RateLimit-Reset", retrySeconds)
+		w.Header().Set("Retry-After", retrySeconds)
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusTooManyRequests)
+		msg := `{"message":"rate limit exceeded"}`
+		if _, err := w.Write([]byte(msg)); err != nil {
+			log.WithError(err).Errorf("Error while writing response: %s", msg)
+		}
+	})
+}
+
+// clientID identifies the client by its API key or by its address. The addresses at the left of X-Forwarded-For are set by the client,
+// so only the ones appended by the trusted proxies are used: the outermost proxy appended the address of the client
+// at the position of the number of trusted hops from the right.
+func clientID(r *http.Request, trustedProxyHops int) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return "key:" + key
+	}
+	if trustedProxyHops > 0 {
+		var hops []string
+		for _, header := range r.Header["X-Forwarded-For"] {
+			hops = append(hops, strings.Split(header, ",")...)
+		}
+		if len(hops) >= trustedProxyHops {
+			return "ip:" + strings.TrimSpace(hops[len(hops)-trustedProxyHops])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,131 @@
+package annotations
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	cfg := AccessConfig{
+		Keys: map[string]string{"partner-key": partnerTier},
+		Tiers: map[string]RateLimit{
+			publicTier:  {Rate: 1, Burst: 2},
+			partnerTier: {Rate: 0},
+		},
+	}
+	registry := metrics.NewRegistry()
+	limiter := NewRateLimiter(cfg, registry)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	log := logger.NewUPPLogger("test-public-annotations-api", "PANIC")
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := APIKeyMiddleware(cfg, log, RateLimitMiddleware(limiter, log, ok))
+
+	do := func(apiKey string, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/content/"+knownUUID+"/annotations", nil)
+		req.RemoteAddr = remoteAddr
+		if apiKey != "" {
+			req.Header.Set(apiKeyHeader, apiKey)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("", "10.0.0.1:1234")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Remaining"))
+
+	rec = do("", "10.0.0.1:1234")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+
+	rec = do("", "10.0.0.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code, "the bucket of the client should be empty")
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"message":"rate limit exceeded"}`, rec.Body.String())
+	assert.Equal(t, int64(1), metrics.GetOrRegisterCounter("ratelimit.throttled.public", registry).Count())
+
+	rec = do("", "10.0.0.2:1234")
+	assert.Equal(t, http.StatusOK, rec.Code, "other clients should have their own bucket")
+
+	for i := 0; i < 5; i++ {
+		rec = do("partner-key", "10.0.0.1:1234")
+		assert.Equal(t, http.StatusOK, rec.Code, "tiers without rate limit should not be throttled")
+	}
+
+	now = now.Add(time.Second)
+	rec = do("", "10.0.0.1:1234")
+	assert.Equal(t, http.StatusOK, rec.Code, "the bucket should be refilled over time")
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	limiter := NewRateLimiter(AccessConfig{}, metrics.NewRegistry())
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	limiter.lastSweep = now
+	// the bucket takes 500s to refill, much longer than the sweep interval
+	slow := RateLimit{Rate: 0.01, Burst: 5}
+
+	for i := 0; i < slow.Burst; i++ {
+		_, _, ok := limiter.allow("ip:10.0.0.1", slow)
+		assert.True(t, ok)
+	}
+	_, _, ok := limiter.allow("ip:10.0.0.1", slow)
+	assert.False(t, ok, "the bucket of the client should be empty")
+
+	now = now.Add(sweepInterval + time.Second)
+	limiter.allow("ip:10.0.0.2", slow)
+	assert.Contains(t, limiter.buckets, "ip:10.0.0.1", "the buckets that are not full again should not be swept")
+	_, _, ok = limiter.allow("ip:10.0.0.1", slow)
+	assert.False(t, ok, "the bucket of the client should not be refilled by a sweep")
+
+	now = now.Add(500 * time.Second)
+	limiter.allow("ip:10.0.0.3", slow)
+	assert.NotContains(t, limiter.buckets, "ip:10.0.0.1", "the buckets idle for longer than burst/rate should be swept")
+	assert.NotContains(t, limiter.buckets, "ip:10.0.0.2")
+}
+
+func TestClientID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "ip:10.0.0.1", clientID(req, 0))
+
+	req.Header.Set("X-Forwarded-For", "1.2.3.4, 192.168.0.1, 10.0.0.2")
+	assert.Equal(t, "ip:10.0.0.1", clientID(req, 0), "X-Forwarded-For should be ignored without trusted proxies")
+	assert.Equal(t, "ip:10.0.0.2", clientID(req, 1), "the address appended by the trusted proxy should be used")
+	assert.Equal(t, "ip:192.168.0.1", clientID(req, 2), "the address appended by the outermost trusted proxy should be used")
+
+	req.Header.Set("X-Forwarded-For", "10.0.0.2")
+	assert.Equal(t, "ip:10.0.0.1", clientID(req, 2), "the connection address should be used when the request bypassed some proxies")
+
+	req.Header.Set(apiKeyHeader, "some-key")
+	assert.Equal(t, "key:some-key", clientID(req, 1))
+}
+
+func TestRateLimitMiddlewareIgnoresSpoofedForwardedFor(t *testing.T) {
+	cfg := AccessConfig{Tiers: map[string]RateLimit{publicTier: {Rate: 1, Burst: 1}}}
+	limiter := NewRateLimiter(cfg, metrics.NewRegistry(), WithTrustedProxyHops(1))
+	handler := APIKeyMiddleware(cfg, logger.NewUPPLogger("test-public-annotations-api", "PANIC"),
+		RateLimitMiddleware(limiter, logger.NewUPPLogger("test-public-annotations-api", "PANIC"), http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+
+	for i, spoofed := range []string{"1.1.1.1", "2.2.2.2"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Forwarded-For", spoofed+", 192.168.0.1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if i == 0 {
+			assert.Equal(t, http.StatusOK, rec.Code)
+			continue
+		}
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code, "rotating the addresses set by the client should not get a new bucket")
+	}
+}
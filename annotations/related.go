@@ -0,0 +1,152 @@
+package annotations
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultRelatedLimit = 10
+	maxRelatedLimit     = 100
+	// implicitRelatedWeight discounts the concepts the content is only implicitly annotated with
+	implicitRelatedWeight = 0.5
+)
+
+// relatedWeights weighs how much a piece of content is about a concept by the relationship annotating it.
+// Concepts annotated by other relationships, e.g. brands and genres, are too broad to relate content.
+var relatedWeights = map[string]float64{
+	"ABOUT":          3,
+	"MAJOR_MENTIONS": 2,
+	"MENTIONS":       1,
+}
+
+// conceptWeight is the weight of a canonical concept for a piece of content.
+type conceptWeight struct {
+	ID     string  `json:"id"`
+	Weight float64 `json:"weight"`
+}
+
+// GetRelatedContent returns the content sharing the most concepts with a piece of content,
+// weighting the concepts by how much each piece of content is about them.
+func GetRelatedContent(hctx *HandlerCtx) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+		limit, err := parseRelatedLimit(r.URL.Query())
+		if err != nil {
+			hctx.Log.WithError(err).Error("invalid query parameter")
+			w.WriteHeader(http.StatusBadRequest)
+			msg := `{"message":"invalid query parameter"}`
+			if _, err = w.Write([]byte(msg)); err != nil {
+				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+			}
+			return
+		}
+
+		res, ok := hctx.readAnnotations(w, r, relatedRoute, "")
+		if !ok {
+			return
+		}
+
+		related := []relatedContent{}
+		if concepts := conceptWeights(res.anns); len(concepts) > 0 {
+			related, err = hctx.AnnotationsDriver.related(res.uuid, concepts, limit)
+			if err != nil {
+				hctx.Log.WithError(err).WithUUID(res.uuid).Error("failed getting related content")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				msg := fmt.Sprintf(`{"message":"Error getting related content for content with uuid %s"}`, res.uuid)
+				if _, err = w.Write([]byte(msg)); err != nil {
+					hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+				}
+				return
+			}
+		}
+
+		hctx.setCacheHeaders(w, r, res)
+		w.WriteHeader(http.StatusOK)
+
+		if err = json.NewEncoder(w).Encode(related); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			msg := fmt.Sprintf(`{"message":"Error parsing related content for content with uuid %s, err=%s"}`, res.uuid, err.Error())
+			hctx.Log.Error(msg)
+			if _, err = w.Write([]byte(msg)); err != nil {
+				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+			}
+		}
+	}
+}
+
+// parseRelatedLimit reads how many pieces of related content to return from the limit query parameter.
+func parseRelatedLimit(params url.Values) (int, error) {
+	values, ok := params["limit"]
+	if !ok {
+		return defaultRelatedLimit, nil
+	}
+	limit, err := strconv.Atoi(values[0])
+	if err != nil || limit < 1 || limit > maxRelatedLimit {
+		return 0, fmt.Errorf("invalid limit value: %s", values[0])
+	}
+	return limit, nil
+}
+
+// conceptWeights weighs the concepts of the annotations by their predicate, keeping the heaviest annotation of each concept.
+// Implicit about annotations weigh as much as explicit ones discounted by implicitRelatedWeight.
+func conceptWeights(anns []annotation) []conceptWeight {
+	weights := map[string]float64{}
+	for _, ann := range anns {
+		weight := predicateRelatedWeight(ann.Predicate)
+		if weight == 0 {
+			continue
+		}
+		id := path.Base(ann.ID)
+		if weight > weights[id] {
+			weights[id] = weight
+		}
+	}
+
+	concepts := make([]conceptWeight, 0, len(weights))
+	for id, weight := range weights {
+		concepts = append(concepts, conceptWeight{ID: id, Weight: weight})
+	}
+	sort.Slice(concepts, func(i, j int) bool { return concepts[i].ID < concepts[j].ID })
+	return concepts
+}
+
+func predicateRelatedWeight(predicate string) float64 {
+	if predicate == predicates["IMPLICITLY_ABOUT"] {
+		return relatedWeights["ABOUT"] * implicitRelatedWeight
+	}
+	for rel, weight := range relatedWeights {
+		if predicates[rel] == predicate {
+			return weight
+		}
+	}
+	return 0
+}
+
+// relatedRelationships returns the relationships relating content, in a stable order.
+func relatedRelationships() []string {
+	rels := make([]string, 0, len(relatedWeights))
+	for rel := range relatedWeights {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	return rels
+}
+
+// relatedWeightCase returns the Cypher expression weighing the given relationship variable.
+func relatedWeightCase(rel string) string {
+	var expr strings.Builder
+	fmt.Fprintf(&expr, "CASE type(%s)", rel)
+	for _, r := range relatedRelationships() {
+		fmt.Fprintf(&expr, " WHEN %q THEN %s", r, strconv.FormatFloat(relatedWeights[r], 'f', -1, 64))
+	}
+	expr.WriteString(" ELSE 0 END")
+	return expr.String()
+}
@@ -0,0 +1,135 @@
+package annotations
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConceptWeights(t *testing.T) {
+	anns := []annotation{
+		{Predicate: predicates["ABOUT"], ID: "http://api.ft.com/things/2cca9e2a-2248-3e48-abc1-93d718b91bbe"},
+		{Predicate: predicates["MENTIONS"], ID: "http://api.ft.com/things/2cca9e2a-2248-3e48-abc1-93d718b91bbe"},
+		{Predicate: predicates["MAJOR_MENTIONS"], ID: "http://api.ft.com/things/5d1510f8-2779-4b74-adab-0a5eb138fca6"},
+		{Predicate: predicates["MENTIONS"], ID: "http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400"},
+		{Predicate: predicates["IMPLICITLY_ABOUT"], ID: "http://api.ft.com/things/8f9b3ee5-4c4a-4c3b-9d2c-a43b6f1b2c3d"},
+		{Predicate: predicates["IS_CLASSIFIED_BY"], ID: "http://api.ft.com/things/dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54"},
+		{Predicate: predicates["IMPLICITLY_CLASSIFIED_BY"], ID: "http://api.ft.com/things/dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54"},
+	}
+
+	expected := []conceptWeight{
+		{ID: "2cca9e2a-2248-3e48-abc1-93d718b91bbe", Weight: 3},
+		{ID: "5d1510f8-2779-4b74-adab-0a5eb138fca6", Weight: 2},
+		{ID: "8f9b3ee5-4c4a-4c3b-9d2c-a43b6f1b2c3d", Weight: 1.5},
+		{ID: "eac853f5-3859-4c08-8540-55e043719400", Weight: 1},
+	}
+	assert.Equal(t, expected, conceptWeights(anns))
+}
+
+func TestRelatedStatement(t *testing.T) {
+	assert.Contains(t, relatedStatement, "MATCH (other:Content)-[rel:ABOUT|MAJOR_MENTIONS|MENTIONS]->(:Concept)-[:EQUIVALENT_TO]->(canonical:Concept{prefUUID:concept.id})")
+	assert.Contains(t, relatedStatement, `max(CASE type(rel) WHEN "ABOUT" THEN 3 WHEN "MAJOR_MENTIONS" THEN 2 WHEN "MENTIONS" THEN 1 ELSE 0 END) as relWeight`)
+}
+
+func TestGetRelatedContent(t *testing.T) {
+	readFunc := func(string, readOptions) (readResult, error) {
+		return readResult{anns: []annotation{
+			{Predicate: predicates["ABOUT"], ID: "http://api.ft.com/things/2cca9e2a-2248-3e48-abc1-93d718b91bbe", Lifecycle: v2Lifecycle},
+			{Predicate: predicates["IS_CLASSIFIED_BY"], ID: "http://api.ft.com/things/dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54", Lifecycle: v2Lifecycle},
+		}, found: true}, nil
+	}
+	related := []relatedContent{{
+		ID:     "http://api.ft.com/things/6c3c1b4e-0f0d-11e9-a3aa-118c761d2745",
+		APIURL: "http://api.ft.com/content/6c3c1b4e-0f0d-11e9-a3aa-118c761d2745",
+		Score:  9,
+		SharedConcepts: []sharedConcept{{
+			ID:        "http://api.ft.com/things/2cca9e2a-2248-3e48-abc1-93d718b91bbe",
+			APIURL:    "http://api.ft.com/things/2cca9e2a-2248-3e48-abc1-93d718b91bbe",
+			Types:     []string{"http://www.ft.com/ontology/core/Thing", "http://www.ft.com/ontology/concept/Concept", "http://www.ft.com/ontology/Topic"},
+			PrefLabel: "Brexit",
+			Weight:    9,
+		}},
+	}}
+	relatedBody := `[{"id":"http://api.ft.com/things/6c3c1b4e-0f0d-11e9-a3aa-118c761d2745","apiUrl":"http://api.ft.com/content/6c3c1b4e-0f0d-11e9-a3aa-118c761d2745","score":9,
+		"sharedConcepts":[{"id":"http://api.ft.com/things/2cca9e2a-2248-3e48-abc1-93d718b91bbe","apiUrl":"http://api.ft.com/things/2cca9e2a-2248-3e48-abc1-93d718b91bbe",
+		"types":["http://www.ft.com/ontology/core/Thing","http://www.ft.com/ontology/concept/Concept","http://www.ft.com/ontology/Topic"],"prefLabel":"Brexit","weight":9}]}]`
+
+	tests := map[string]struct {
+		query              string
+		readFunc           func(string, readOptions) (readResult, error)
+		relatedFunc        func(string, []conceptWeight, int) ([]relatedContent, error)
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		"related content": {
+			readFunc: readFunc,
+			relatedFunc: func(uuid string, concepts []conceptWeight, limit int) ([]relatedContent, error) {
+				if uuid != knownUUID || limit != defaultRelatedLimit {
+					return nil, fmt.Errorf("unexpected uuid %s or limit %d", uuid, limit)
+				}
+				if len(concepts) != 1 || concepts[0] != (conceptWeight{ID: "2cca9e2a-2248-3e48-abc1-93d718b91bbe", Weight: 3}) {
+					return nil, fmt.Errorf("unexpected concepts %v", concepts)
+				}
+				return related, nil
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       relatedBody,
+		},
+		"related content with a limit": {
+			query:    "?limit=1",
+			readFunc: readFunc,
+			relatedFunc: func(_ string, _ []conceptWeight, limit int) ([]relatedContent, error) {
+				if limit != 1 {
+					return nil, fmt.Errorf("unexpected limit %d", limit)
+				}
+				return related, nil
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       relatedBody,
+		},
+		"content without weighted concepts": {
+			readFunc: func(string, readOptions) (readResult, error) {
+				return readResult{anns: []annotation{
+					{Predicate: predicates["IS_CLASSIFIED_BY"], ID: "http://api.ft.com/things/dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54", Lifecycle: v2Lifecycle},
+				}, found: true}, nil
+			},
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `[]`,
+		},
+		"invalid limit": {
+			query:              "?limit=1000",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"message":"invalid query parameter"}`,
+		},
+		"related content error": {
+			readFunc: readFunc,
+			relatedFunc: func(string, []conceptWeight, int) ([]relatedContent, error) {
+				return nil, errors.New("test error")
+			},
+			expectedStatusCode: http.StatusServiceUnavailable,
+			expectedBody:       fmt.Sprintf(`{"message":"Error getting related content for content with uuid %s"}`, knownUUID),
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := mockDriver{readFunc: tc.readFunc, relatedFunc: tc.relatedFunc}
+			hctx := NewHandlerCtx(d, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+			r := mux.NewRouter()
+			r.HandleFunc("/content/{uuid}/related", GetRelatedContent(hctx)).Methods("GET")
+
+			req := httptest.NewRequest("GET", fmt.Sprintf("/content/%s/related%s", knownUUID, tc.query), nil)
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			assert.JSONEq(t, tc.expectedBody, rec.Body.String())
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package annotations
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// implicitPredicates are the predicates of the annotations derived from the concepts the content is annotated with.
+var implicitPredicates = map[string]bool{
+	predicates["IMPLICITLY_CLASSIFIED_BY"]: true,
+	predicates["IMPLICITLY_ABOUT"]:         true,
+}
+
+// annotationsSummary counts the annotations of a piece of content.
+type annotationsSummary struct {
+	Total int `json:"total"`
+	// Predicates counts the annotations per predicate URI
+	Predicates map[string]int `json:"predicates"`
+	// Types counts the annotations per most specific type URI of the concept
+	Types map[string]int `json:"types"`
+	// Lifecycles counts the annotations per annotation lifecycle, only for the partners as the views and the lifecycle groups
+	Lifecycles map[string]int `json:"lifecycles,omitempty"`
+	Explicit   int            `json:"explicit"`
+	Implicit   int            `json:"implicit"`
+	Deprecated int            `json:"deprecated"`
+}
+
+// GetAnnotationsSummary returns counts of the annotations of a piece of content,
+// computed from the same filtered annotations served by the annotations endpoint.
+func GetAnnotationsSummary(hctx *HandlerCtx) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		res, ok := hctx.readAnnotations(w, r, summaryRoute, "")
+		if !ok {
+			return
+		}
+
+		summary := summarise(res.anns, tierFromRequest(r))
+
+		hctx.setCacheHeaders(w, r, res)
+		w.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(w).Encode(summary); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			msg := fmt.Sprintf(`{"message":"Error parsing annotations summary for content with uuid %s, err=%s"}`, res.uuid, err.Error())
+			hctx.Log.Error(msg)
+			if _, err = w.Write([]byte(msg)); err != nil {
+				hctx.Log.WithError(err).Errorf("Error while writing response: %s", msg)
+			}
+		}
+	}
+}
+
+func summarise(anns []annotation, tier string) annotationsSummary {
+	summary := annotationsSummary{
+		Total:      len(anns),
+		Predicates: map[string]int{},
+		Types:      map[string]int{},
+	}
+	if tierLevel(tier) >= tierLevel(partnerTier) {
+		summary.Lifecycles = map[string]int{}
+	}
+	for _, ann := range anns {
+		summary.Predicates[ann.Predicate]++
+		if len(ann.Types) > 0 {
+			// types are ordered from the most generic to the most specific one
+			summary.Types[ann.Types[len(ann.Types)-1]]++
+		}
+		if summary.Lifecycles != nil && ann.Lifecycle != "" {
+			summary.Lifecycles[ann.Lifecycle]++
+		}
+		if implicitPredicates[ann.Predicate] {
+			summary.Implicit++
+		} else {
+			summary.Explicit++
+		}
+		if ann.IsDeprecated {
+			summary.Deprecated++
+		}
+	}
+	return summary
+}
@@ -0,0 +1,119 @@
+package annotations
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAnnotationsSummary(t *testing.T) {
+	d := mockDriver{
+		readFunc: func(uuid string, _ readOptions) (readResult, error) {
+			if uuid != knownUUID {
+				return readResult{}, nil
+			}
+			return readResult{anns: []annotation{
+				{
+					Predicate: "http://www.ft.com/ontology/annotation/about",
+					ID:        "http://api.ft.com/things/2cca9e2a-2248-3e48-abc1-93d718b91bbe",
+					Types:     []string{"http://www.ft.com/ontology/core/Thing", "http://www.ft.com/ontology/concept/Concept", "http://www.ft.com/ontology/Topic"},
+					Lifecycle: "annotations-v2",
+				},
+				{
+					Predicate:    "http://www.ft.com/ontology/annotation/mentions",
+					ID:           "http://api.ft.com/things/eac853f5-3859-4c08-8540-55e043719400",
+					Types:        []string{"http://www.ft.com/ontology/core/Thing", "http://www.ft.com/ontology/concept/Concept", "http://www.ft.com/ontology/organisation/Organisation"},
+					Lifecycle:    "annotations-v2",
+					IsDeprecated: true,
+				},
+				{
+					Predicate: "http://www.ft.com/ontology/classification/isClassifiedBy",
+					ID:        "http://api.ft.com/things/dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54",
+					Types:     []string{"http://www.ft.com/ontology/core/Thing", "http://www.ft.com/ontology/concept/Concept", "http://www.ft.com/ontology/product/Brand"},
+					Lifecycle: "annotations-pac",
+				},
+				{
+					Predicate: "http://www.ft.com/ontology/implicitlyAbout",
+					ID:        "http://api.ft.com/things/8f9b3ee5-4c4a-4c3b-9d2c-a43b6f1b2c3d",
+					Types:     []string{"http://www.ft.com/ontology/core/Thing", "http://www.ft.com/ontology/concept/Concept", "http://www.ft.com/ontology/Topic"},
+					Lifecycle: "annotations-v2",
+				},
+			}, found: true}, nil
+		},
+	}
+	tests := map[string]struct {
+		uuid               string
+		query              string
+		tier               string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		"summary of the annotations": {
+			uuid:               knownUUID,
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `{"total":4,
+				"predicates":{"http://www.ft.com/ontology/annotation/about":1,"http://www.ft.com/ontology/annotation/mentions":1,"http://www.ft.com/ontology/classification/isClassifiedBy":1,"http://www.ft.com/ontology/implicitlyAbout":1},
+				"types":{"http://www.ft.com/ontology/Topic":2,"http://www.ft.com/ontology/organisation/Organisation":1,"http://www.ft.com/ontology/product/Brand":1},
+				"explicit":3,"implicit":1,"deprecated":1}`,
+		},
+		"summary of the annotations for a partner": {
+			uuid:               knownUUID,
+			tier:               partnerTier,
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `{"total":4,
+				"predicates":{"http://www.ft.com/ontology/annotation/about":1,"http://www.ft.com/ontology/annotation/mentions":1,"http://www.ft.com/ontology/classification/isClassifiedBy":1,"http://www.ft.com/ontology/implicitlyAbout":1},
+				"types":{"http://www.ft.com/ontology/Topic":2,"http://www.ft.com/ontology/organisation/Organisation":1,"http://www.ft.com/ontology/product/Brand":1},
+				"lifecycles":{"annotations-v2":3,"annotations-pac":1},
+				"explicit":3,"implicit":1,"deprecated":1}`,
+		},
+		"summary of the filtered annotations": {
+			uuid:               knownUUID,
+			query:              "?lifecycle=pac",
+			tier:               partnerTier,
+			expectedStatusCode: http.StatusOK,
+			expectedBody: `{"total":1,
+				"predicates":{"http://www.ft.com/ontology/classification/isClassifiedBy":1},
+				"types":{"http://www.ft.com/ontology/product/Brand":1},
+				"lifecycles":{"annotations-pac":1},
+				"explicit":1,"implicit":0,"deprecated":0}`,
+		},
+		"invalid query parameters are rejected": {
+			uuid:               knownUUID,
+			query:              "?lifecycle=unknown",
+			expectedStatusCode: http.StatusBadRequest,
+			expectedBody:       `{"message":"invalid query parameter"}`,
+		},
+		"content without annotations": {
+			uuid:               "99999999-0000-0000-0000-000000000000",
+			expectedStatusCode: http.StatusNotFound,
+			expectedBody:       `{"message":"No annotations found for content with uuid 99999999-0000-0000-0000-000000000000."}`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			hctx := NewHandlerCtx(d, "test-header", logger.NewUPPLogger("test-public-annotations-api", "PANIC"))
+			r := mux.NewRouter()
+			r.HandleFunc("/content/{uuid}/annotations/summary", GetAnnotationsSummary(hctx)).Methods("GET")
+
+			req := httptest.NewRequest("GET", fmt.Sprintf("/content/%s/annotations/summary%s", tc.uuid, tc.query), nil)
+			if tc.tier != "" {
+				req = req.WithContext(context.WithValue(req.Context(), tierContextKey{}, tc.tier))
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedStatusCode, rec.Code)
+			assert.JSONEq(t, tc.expectedBody, rec.Body.String())
+			if tc.expectedStatusCode == http.StatusOK {
+				assert.Equal(t, tierCacheControl(req, "test-header"), rec.Header().Get("Cache-Control"))
+			}
+		})
+	}
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"fmt"
 	"strconv"
@@ -49,6 +53,102 @@ func main() {
 		Desc:   "Duration Get requests should be cached for. e.g. 2h45m would set the max-age value to '7440' seconds",
 		EnvVar: "CACHE_DURATION",
 	})
+	accessConfig := app.String(cli.StringOpt{
+		Name:   "api-keys-config",
+		Value:  "",
+		Desc:   "Path to a JSON file mapping API keys to access tiers and configuring the rate limits of each tier. Without it every caller gets the public tier and no rate limits apply",
+		EnvVar: "API_KEYS_CONFIG",
+	})
+	trustedProxyHops := app.Int(cli.IntOpt{
+		Name:   "trusted-proxy-hops",
+		Value:  0,
+		Desc:   "Number of proxies in front of the service appending the address of their client to X-Forwarded-For. Callers without an API key are rate limited by the address seen by the outermost of them, or by the address of the connection when 0",
+		EnvVar: "TRUSTED_PROXY_HOPS",
+	})
+	derivationTimeout := app.String(cli.StringOpt{
+		Name:   "derivation-timeout",
+		Value:  "5s",
+		Desc:   "Duration a request waits for the implicit annotations queries before responding without their results",
+		EnvVar: "DERIVATION_TIMEOUT",
+	})
+	derivationRules := app.String(cli.StringOpt{
+		Name:   "derivation-rules-config",
+		Value:  "",
+		Desc:   "Path to a JSON file declaring the implicit annotations derivation rules. Without it the default rules apply",
+		EnvVar: "DERIVATION_RULES_CONFIG",
+	})
+	filtersConfig := app.String(cli.StringOpt{
+		Name:   "filters-config",
+		Value:  "",
+		Desc:   "Path to a JSON file mapping the routes to the names of the filters applied to their annotations. Without it every route applies the lifecycle, importance and dedup filters",
+		EnvVar: "FILTERS_CONFIG",
+	})
+	historyFile := app.String(cli.StringOpt{
+		Name:   "annotations-history-file",
+		Value:  "",
+		Desc:   "Path to the shared append-only JSON lines file where the record-history command appends the annotations of a piece of content every time they are written, used by the asOf query parameter and the history endpoint. The history is disabled when not set",
+		EnvVar: "ANNOTATIONS_HISTORY_FILE",
+	})
+	historyRetention := app.String(cli.StringOpt{
+		Name:   "annotations-history-retention",
+		Value:  "2160h",
+		Desc:   "Period of the annotations history held in memory and served, 0 for the whole history",
+		EnvVar: "ANNOTATIONS_HISTORY_RETENTION",
+	})
+	changesFile := app.String(cli.StringOpt{
+		Name:   "annotations-changes-file",
+		Value:  "",
+		Desc:   "Path to a JSON lines file where the annotations changes streamed by the changes endpoint are appended, in the format of the history file. Without it the snapshots appended to the annotations history file are streamed",
+		EnvVar: "ANNOTATIONS_CHANGES_FILE",
+	})
+	changesPollInterval := app.String(cli.StringOpt{
+		Name:   "annotations-changes-poll-interval",
+		Value:  "1s",
+		Desc:   "Interval the annotations history and changes files are polled at for new lines",
+		EnvVar: "ANNOTATIONS_CHANGES_POLL_INTERVAL",
+	})
+	maxBrandDepth := app.Int(cli.IntOpt{
+		Name:   "max-brand-depth",
+		Value:  0,
+		Desc:   "Maximum number of levels of parent brands returned as implicit annotations, 0 for the maximum depth of the brandParents rule",
+		EnvVar: "MAX_BRAND_DEPTH",
+	})
+	maxImpliedByDepth := app.Int(cli.IntOpt{
+		Name:   "max-implied-by-depth",
+		Value:  0,
+		Desc:   "Maximum length of the IMPLIED_BY chains followed from topics to the brands they imply, 0 for the maximum depth of the impliedBy rule",
+		EnvVar: "MAX_IMPLIED_BY_DEPTH",
+	})
+	maxBroaderDepth := app.Int(cli.IntOpt{
+		Name:   "max-broader-depth",
+		Value:  0,
+		Desc:   "Maximum number of levels of broader concepts returned as implicit abouts, 0 for the maximum depth of the broader rule",
+		EnvVar: "MAX_BROADER_DEPTH",
+	})
+	canaryContentUUID := app.String(cli.StringOpt{
+		Name:   "canary-content-uuid",
+		Value:  "",
+		Desc:   "UUID of a piece of content with annotations that is read by the canary healthcheck. The check is disabled when not set",
+		EnvVar: "CANARY_CONTENT_UUID",
+	})
+	canaryLatencySLO := app.String(cli.StringOpt{
+		Name:   "canary-latency-slo",
+		Value:  "2s",
+		Desc:   "Maximum duration of the canary read before the canary healthcheck fails",
+		EnvVar: "CANARY_LATENCY_SLO",
+	})
+	drainPeriod := app.String(cli.StringOpt{
+		Name:   "drain-period",
+		Value:  "10s",
+		Desc:   "Duration the service keeps serving requests after receiving SIGTERM while reporting not good to go, so that it is taken out of load balancing",
+		EnvVar: "DRAIN_PERIOD",
+	})
+	shutdownTimeout := app.String(cli.StringOpt{
+		Name:   "shutdown-timeout",
+		Value:  "20s",
+		Desc:   "Deadline for in-flight requests to complete once the drain period is over",
+		EnvVar: "SHUTDOWN_TIMEOUT",
+	})
 	logLevel := app.String(cli.StringOpt{
 		Name:   "log-level",
 		Value:  "info",
@@ -58,15 +158,74 @@ func main() {
 
 	log := logger.NewUPPLogger("public-annotations-api", *logLevel)
 
+	config := func() serverConfig {
+		return serverConfig{
+			neoURL:            *neoURL,
+			port:              *port,
+			cacheDuration:     *cacheDuration,
+			env:               *env,
+			accessConfigPath:  *accessConfig,
+			trustedProxyHops:  *trustedProxyHops,
+			derivationTimeout: *derivationTimeout,
+			derivationRules:   *derivationRules,
+			filtersConfig:     *filtersConfig,
+			historyFile:       *historyFile,
+			historyRetention:  *historyRetention,
+			changesFile:       *changesFile,
+			changesPoll:       *changesPollInterval,
+			maxBrandDepth:     *maxBrandDepth,
+			maxImpliedByDepth: *maxImpliedByDepth,
+			maxBroaderDepth:   *maxBroaderDepth,
+			canaryUUID:        *canaryContentUUID,
+			canaryLatencySLO:  *canaryLatencySLO,
+			drainPeriod:       *drainPeriod,
+			shutdownTimeout:   *shutdownTimeout,
+		}
+	}
+
 	app.Action = func() {
 		log.Infof("public-annotations-api will listen on port: %s, connecting to: %s", *port, *neoURL)
-		err := runServer(*neoURL, *port, *cacheDuration, *env, log)
+		err := runServer(config(), log)
 		if err != nil {
 			log.WithError(err).Error("failed to start public-annotations-api service")
 			return
 		}
 	}
 
+	app.Command("get", "Print the annotations of a piece of content as served by the annotations endpoint", func(cmd *cli.Cmd) {
+		cmd.Spec = "[--lifecycle...] [--fields...] [--format] UUID"
+		uuid := cmd.StringArg("UUID", "", "UUID of the piece of content")
+		lifecycles := cmd.StringsOpt("lifecycle", nil, "Lifecycles of the annotations to print, as the lifecycle query parameter")
+		fields := cmd.StringsOpt("fields", nil, "Fields of the annotations to print, as the fields query parameter")
+		format := cmd.StringOpt("format", annotations.JSONFormat, "Format of the annotations, json or csv")
+		cmd.Action = func() {
+			runCommand(config(), log, func(hctx *annotations.HandlerCtx) error {
+				return hctx.PrintAnnotations(os.Stdout, *uuid, *lifecycles, *fields, *format)
+			})
+		}
+	})
+	app.Command("explain", "Print which filter drops each annotation of a piece of content and why", func(cmd *cli.Cmd) {
+		cmd.Spec = "[--lifecycle...] UUID"
+		uuid := cmd.StringArg("UUID", "", "UUID of the piece of content")
+		lifecycles := cmd.StringsOpt("lifecycle", nil, "Lifecycles of the annotations to keep, as the lifecycle query parameter")
+		cmd.Action = func() {
+			runCommand(config(), log, func(hctx *annotations.HandlerCtx) error {
+				return hctx.ExplainAnnotations(os.Stdout, *uuid, *lifecycles)
+			})
+		}
+	})
+
+	app.Command("record-history", "Append the annotations of the content whose uuids are read from the standard input, one per line, to the annotations history file", func(cmd *cli.Cmd) {
+		cmd.Action = func() {
+			runCommand(config(), log, func(hctx *annotations.HandlerCtx) error {
+				if *historyFile == "" {
+					return errors.New("the annotations history file is not set")
+				}
+				return hctx.RecordHistory(os.Stdin, *historyFile)
+			})
+		}
+	})
+
 	log.Infof("Application started with args %s", os.Args)
 	err := app.Run(os.Args)
 	if err != nil {
@@ -75,13 +234,133 @@ func main() {
 	}
 }
 
-func runServer(neoURL string, port string, cacheDuration string, env string, log *logger.UPPLogger) error {
-	duration, durationErr := time.ParseDuration(cacheDuration)
+type serverConfig struct {
+	neoURL            string
+	port              string
+	cacheDuration     string
+	env               string
+	accessConfigPath  string
+	trustedProxyHops  int
+	derivationTimeout string
+	derivationRules   string
+	filtersConfig     string
+	historyFile       string
+	historyRetention  string
+	changesFile       string
+	changesPoll       string
+	maxBrandDepth     int
+	maxImpliedByDepth int
+	maxBroaderDepth   int
+	canaryUUID        string
+	canaryLatencySLO  string
+	drainPeriod       string
+	shutdownTimeout   string
+}
+
+func runServer(cfg serverConfig, log *logger.UPPLogger) error {
+	duration, durationErr := time.ParseDuration(cfg.cacheDuration)
 	if durationErr != nil {
 		return fmt.Errorf("failed to parse cache duration string: %w", durationErr)
 	}
+	if cfg.trustedProxyHops < 0 {
+		return fmt.Errorf("invalid number of trusted proxy hops: %d", cfg.trustedProxyHops)
+	}
+	drainPeriod, err := time.ParseDuration(cfg.drainPeriod)
+	if err != nil {
+		return fmt.Errorf("failed to parse drain period string: %w", err)
+	}
+	shutdownTimeout, err := time.ParseDuration(cfg.shutdownTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to parse shutdown timeout string: %w", err)
+	}
+	canaryLatencySLO, err := time.ParseDuration(cfg.canaryLatencySLO)
+	if err != nil {
+		return fmt.Errorf("failed to parse canary latency SLO string: %w", err)
+	}
+	changesPoll, err := time.ParseDuration(cfg.changesPoll)
+	if err != nil {
+		return fmt.Errorf("failed to parse annotations changes poll interval string: %w", err)
+	}
+	historyRetention, err := time.ParseDuration(cfg.historyRetention)
+	if err != nil {
+		return fmt.Errorf("failed to parse annotations history retention string: %w", err)
+	}
+	if historyRetention < 0 {
+		return fmt.Errorf("invalid annotations history retention: %s", historyRetention)
+	}
+	accessConfig, err := annotations.LoadAccessConfig(cfg.accessConfigPath)
+	if err != nil {
+		return err
+	}
 	cacheControlHeader := fmt.Sprintf("max-age=%s, public", strconv.FormatFloat(duration.Seconds(), 'f', 0, 64))
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var handlerOpts []func(*annotations.HandlerCtx)
+	if cfg.historyFile != "" {
+		history, err := annotations.NewFileHistoryStore(cfg.historyFile, historyRetention, log)
+		if err != nil {
+			return err
+		}
+		go history.Watch(ctx, changesPoll)
+		handlerOpts = append(handlerOpts, annotations.WithHistory(history))
+	}
+	changesFile := cfg.changesFile
+	if changesFile == "" {
+		changesFile = cfg.historyFile
+	}
+	if changesFile != "" {
+		changes, err := annotations.NewFileChangeSource(changesFile, 0, log)
+		if err != nil {
+			return err
+		}
+		go changes.Watch(ctx, changesPoll)
+		handlerOpts = append(handlerOpts, annotations.WithChangeSource(changes))
+	}
+	handlersCtx, err := newHandlerCtx(cfg, true, cacheControlHeader, log, handlerOpts...)
+	if err != nil {
+		return err
+	}
+	checks := []fthealth.Check{
+		annotations.HealthCheck(handlersCtx),
+		annotations.IndexesHealthCheck(handlersCtx),
+	}
+	if cfg.canaryUUID != "" {
+		checks = append(checks, annotations.CanaryHealthCheck(handlersCtx, cfg.canaryUUID, canaryLatencySLO))
+	}
+
+	router := routeRequests(handlersCtx, accessConfig, cfg.trustedProxyHops, checks)
+	return serve(cfg.port, router, handlersCtx, drainPeriod, shutdownTimeout)
+}
+
+// runCommand runs a command against the configured neo4j, exiting with a non-zero status when it fails.
+func runCommand(cfg serverConfig, log *logger.UPPLogger, command func(*annotations.HandlerCtx) error) {
+	hctx, err := newHandlerCtx(cfg, false, "", log)
+	if err == nil {
+		err = command(hctx)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		cli.Exit(1)
+	}
+}
+
+// newHandlerCtx loads the derivation rules and the filters configuration, and connects the annotations driver to neo4j.
+// The server connects in the background so that it starts while neo4j is unavailable, the commands fail instead.
+func newHandlerCtx(cfg serverConfig, backgroundConnect bool, cacheControlHeader string, log *logger.UPPLogger, opts ...func(*annotations.HandlerCtx)) (*annotations.HandlerCtx, error) {
+	derivationTimeout, err := time.ParseDuration(cfg.derivationTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse derivation timeout string: %w", err)
+	}
+	derivations, err := annotations.LoadDerivationRules(cfg.derivationRules)
+	if err != nil {
+		return nil, err
+	}
+	filters, err := annotations.LoadFiltersConfig(cfg.filtersConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	conf := neoutils.ConnectionConfig{
 		BatchSize:     1024,
 		Transactional: false,
@@ -91,19 +370,42 @@ func runServer(neoURL string, port string, cacheDuration string, env string, log
 			},
 			Timeout: 1 * time.Minute,
 		},
-		BackgroundConnect: true,
+		BackgroundConnect: backgroundConnect,
 	}
-	db, err := neoutils.Connect(neoURL, &conf, log)
+	db, err := neoutils.Connect(cfg.neoURL, &conf, log)
 	if err != nil {
-		return fmt.Errorf("failed connecting to neo4j: %w", err)
+		return nil, fmt.Errorf("failed connecting to neo4j: %w", err)
 	}
 
-	annotationsDriver := annotations.NewCypherDriver(db, env)
-	handlersCtx := annotations.NewHandlerCtx(annotationsDriver, cacheControlHeader, log)
-	return routeRequests(port, handlersCtx)
+	cypherDriver := annotations.NewCypherDriver(db, cfg.env,
+		annotations.WithDerivationRules(derivations),
+		annotations.WithDerivationTimeout(derivationTimeout),
+		annotations.WithMaxDepth("brandParents", cfg.maxBrandDepth),
+		annotations.WithMaxDepth("impliedBy", cfg.maxImpliedByDepth),
+		annotations.WithMaxDepth("broader", cfg.maxBroaderDepth),
+		annotations.WithLogger(log),
+		annotations.WithMetricsRegistry(metrics.DefaultRegistry),
+	)
+	maxDepths := map[string]int{
+		"brandParents": cfg.maxBrandDepth,
+		"impliedBy":    cfg.maxImpliedByDepth,
+		"broader":      cfg.maxBroaderDepth,
+	}
+	for name, depth := range maxDepths {
+		if depth == 0 {
+			continue
+		}
+		if err = cypherDriver.CheckMaxDepth(name); err != nil {
+			return nil, fmt.Errorf("invalid maximum depth %d: %w", depth, err)
+		}
+	}
+	annotationsDriver := annotations.NewCoalescingDriver(cypherDriver, metrics.DefaultRegistry)
+	opts = append([]func(*annotations.HandlerCtx){annotations.WithFilters(filters)}, opts...)
+	return annotations.NewHandlerCtx(annotationsDriver, cacheControlHeader, log, opts...), nil
 }
 
-func routeRequests(port string, hctx *annotations.HandlerCtx) error {
+func routeRequests(hctx *annotations.HandlerCtx, accessConfig annotations.AccessConfig, trustedProxyHops int, checks []fthealth.Check) http.Handler {
+	serveMux := http.NewServeMux()
 
 	// Standard endpoints
 	healthCheck := fthealth.TimedHealthCheck{
@@ -111,31 +413,67 @@ func routeRequests(port string, hctx *annotations.HandlerCtx) error {
 			SystemCode:  "annotationsapi",
 			Name:        "public-annotations-api",
 			Description: appDescription,
-			Checks: []fthealth.Check{
-				annotations.HealthCheck(hctx),
-			},
+			Checks:      checks,
 		},
 		Timeout: 10 * time.Second,
 	}
-	http.HandleFunc("/__health", fthealth.Handler(healthCheck))
-	http.HandleFunc(status.GTGPath, status.NewGoodToGoHandler(annotations.GoodToGo(hctx)))
-	http.HandleFunc(status.BuildInfoPath, status.BuildInfoHandler)
+	serveMux.HandleFunc("/__health", fthealth.Handler(healthCheck))
+	serveMux.HandleFunc(status.GTGPath, status.NewGoodToGoHandler(annotations.GoodToGo(hctx)))
+	serveMux.HandleFunc(status.BuildInfoPath, status.BuildInfoHandler)
 
 	// API specific endpoints
 	servicesRouter := mux.NewRouter()
 
+	servicesRouter.HandleFunc("/content/annotations/changes", annotations.GetAnnotationsChanges(hctx)).Methods("GET")
+	servicesRouter.HandleFunc("/content/annotations/changes", annotations.MethodNotAllowedHandler)
+	servicesRouter.HandleFunc("/content/{uuid}/annotations/history", annotations.GetAnnotationsHistory(hctx)).Methods("GET")
+	servicesRouter.HandleFunc("/content/{uuid}/annotations/history", annotations.MethodNotAllowedHandler)
+	servicesRouter.HandleFunc("/content/{uuid}/annotations/summary", annotations.GetAnnotationsSummary(hctx)).Methods("GET")
+	servicesRouter.HandleFunc("/content/{uuid}/annotations/summary", annotations.MethodNotAllowedHandler)
+	servicesRouter.HandleFunc("/content/{uuid}/related", annotations.GetRelatedContent(hctx)).Methods("GET")
+	servicesRouter.HandleFunc("/content/{uuid}/related", annotations.MethodNotAllowedHandler)
 	servicesRouter.HandleFunc("/content/{uuid}/annotations", annotations.GetAnnotations(hctx)).Methods("GET")
 	servicesRouter.HandleFunc("/content/{uuid}/annotations", annotations.MethodNotAllowedHandler)
 
 	var monitoringRouter http.Handler = servicesRouter
+	monitoringRouter = annotations.RateLimitMiddleware(annotations.NewRateLimiter(accessConfig, metrics.DefaultRegistry, annotations.WithTrustedProxyHops(trustedProxyHops)), hctx.Log, monitoringRouter)
+	monitoringRouter = annotations.APIKeyMiddleware(accessConfig, hctx.Log, monitoringRouter)
 	monitoringRouter = httphandlers.TransactionAwareRequestLoggingHandler(hctx.Log, monitoringRouter)
 	monitoringRouter = httphandlers.HTTPMetricsHandler(metrics.DefaultRegistry, monitoringRouter)
 
-	http.Handle("/", monitoringRouter)
+	serveMux.Handle("/", monitoringRouter)
 
-	err := http.ListenAndServe(":"+port, nil)
-	if err != nil {
+	return serveMux
+}
+
+// serve runs the http server until SIGTERM or SIGINT is received.
+// It then reports not good to go for the drain period and shuts the server down, waiting up to the timeout for in-flight requests.
+func serve(port string, handler http.Handler, hctx *annotations.HandlerCtx, drainPeriod time.Duration, shutdownTimeout time.Duration) error {
+	server := &http.Server{Addr: ":" + port, Handler: handler}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	select {
+	case err := <-serverErr:
 		return fmt.Errorf("failed to start server: %w", err)
+	case sig := <-signals:
+		hctx.Log.Infof("Received %s, draining connections for %s", sig, drainPeriod)
+	}
+
+	hctx.MarkShuttingDown()
+	time.Sleep(drainPeriod)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shut down server gracefully: %w", err)
 	}
+	hctx.Log.Info("Server shut down gracefully")
 	return nil
 }